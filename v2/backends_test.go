@@ -0,0 +1,90 @@
+package remember_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/tsawler/remember/v2"
+	"github.com/tsawler/remember/v2/bolt"
+	"github.com/tsawler/remember/v2/internal/cachetest"
+	"github.com/tsawler/remember/v2/memcached"
+	"github.com/tsawler/remember/v2/sqlcache"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// backends lists every cache type, for the tests in cachetest which they must all pass.
+var backends = []cachetest.Backend{
+	{Name: "redis", New: func(t *testing.T) cachetest.Caches {
+		s := miniredis.RunT(t)
+		open := opener(t)
+		return cachetest.Caches{
+			Cache: open(remember.NewRedis(remember.WithAddr(s.Addr()), remember.WithPrefix("test"))),
+			Other: open(remember.NewRedis(remember.WithAddr(s.Addr()), remember.WithPrefix("other"))),
+			Wait:  s.FastForward,
+		}
+	}},
+	{Name: "badger", ShortTTL: time.Second, New: func(t *testing.T) cachetest.Caches {
+		cache, err := remember.NewBadger(remember.WithBadgerPath(filepath.Join(t.TempDir(), "badger")), remember.WithPrefix("test"))
+		opener(t)(cache, err)
+		return cachetest.Caches{Cache: cache, Other: remember.NewBadgerFromDB(cache.Conn, &remember.Options{Prefix: "other"})}
+	}},
+	{Name: "buntdb", New: func(t *testing.T) cachetest.Caches {
+		cache, err := remember.NewBuntDB(remember.WithPrefix("test"))
+		opener(t)(cache, err)
+		return cachetest.Caches{Cache: cache, Other: remember.NewBuntDBFromDB(cache.Conn, &remember.Options{Prefix: "other"})}
+	}},
+	{Name: "memory", New: func(t *testing.T) cachetest.Caches {
+		return cachetest.Caches{Cache: opener(t)(remember.NewMemory())}
+	}},
+	{Name: "memcached", New: func(t *testing.T) cachetest.Caches {
+		server := cachetest.StartMemcached(t)
+		open := opener(t)
+		return cachetest.Caches{
+			Cache: open(memcached.New(memcached.WithServers(server.Addr()), remember.WithPrefix("test"))),
+			Other: open(memcached.New(memcached.WithServers(server.Addr()), remember.WithPrefix("other"))),
+		}
+	}},
+	{Name: "sql", New: func(t *testing.T) cachetest.Caches {
+		cache, err := sqlcache.New(sqlcache.WithDataSource("sqlite3", filepath.Join(t.TempDir(), "cache.db")), remember.WithPrefix("test"))
+		opener(t)(cache, err)
+		other, err := sqlcache.NewFromDB(cache.Conn, &remember.Options{Prefix: "other", SQLDriver: "sqlite3"})
+		opener(t)(other, err)
+		return cachetest.Caches{Cache: cache, Other: other}
+	}},
+	{Name: "bolt", New: func(t *testing.T) cachetest.Caches {
+		cache, err := bolt.New(bolt.WithPath(filepath.Join(t.TempDir(), "bolt.db")), remember.WithPrefix("test"))
+		opener(t)(cache, err)
+		other, err := bolt.NewFromDB(cache.Conn, &remember.Options{Prefix: "other"})
+		opener(t)(other, err)
+		return cachetest.Caches{Cache: cache, Other: other}
+	}},
+	{Name: "file", New: func(t *testing.T) cachetest.Caches {
+		dir := t.TempDir()
+		open := opener(t)
+		return cachetest.Caches{
+			Cache: open(remember.NewFile(remember.WithFilePath(dir), remember.WithPrefix("test"))),
+			Other: open(remember.NewFile(remember.WithFilePath(dir), remember.WithPrefix("other"))),
+		}
+	}},
+}
+
+// opener returns a function which fails t if a cache could not be created, and otherwise closes the
+// cache when the test ends.
+func opener(t *testing.T) func(remember.CacheInterface, error) remember.CacheInterface {
+	return func(cache remember.CacheInterface, err error) remember.CacheInterface {
+		t.Helper()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = cache.Close() })
+		return cache
+	}
+}
+
+func TestBackends(t *testing.T) {
+	cachetest.Run(t, backends)
+}
@@ -1,36 +1,103 @@
 package remember
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"github.com/dgraph-io/badger/v3"
+	"github.com/tsawler/toolbox"
+	"golang.org/x/sync/singleflight"
 	"time"
 )
 
-// BadgerCache is the type for a Badger database cache.
+// BadgerCache is the type for a Badger database cache. When Prefix is set, every key is stored as
+// "prefix:key", so that Empty and EmptyByMatch only touch this client's keys even when several clients
+// share one database. With an empty Prefix, keys are stored as given.
 type BadgerCache struct {
-	Conn   *badger.DB
-	Prefix string
+	Conn     *badger.DB
+	Prefix   string
+	Codec    Codec // The codec used to serialize values. Defaults to GobCodec.
+	KeepOpen bool  // If true, Close leaves Conn open, for databases owned by the caller.
+	group    singleflight.Group
+}
+
+// NewBadgerFromDB returns a cache which uses an existing Badger database, taking Prefix and Codec
+// from the optional options. Close leaves the database open unless KeepOpen is set to false.
+func NewBadgerFromDB(db *badger.DB, o ...*Options) *BadgerCache {
+	ops := firstOptions(o)
+	return &BadgerCache{
+		Conn:     db,
+		Prefix:   ops.Prefix,
+		Codec:    ops.Codec,
+		KeepOpen: true,
+	}
 }
 
 // Has checks for existence of item in cache.
 func (b *BadgerCache) Has(str string) bool {
-	_, err := b.Get(str)
+	return b.HasCtx(context.Background(), str)
+}
+
+// HasCtx checks for existence of item in cache, returning false if ctx is already done.
+func (b *BadgerCache) HasCtx(ctx context.Context, str string) bool {
+	_, err := b.GetCtx(ctx, str)
 	if err != nil {
 		return false
 	}
 	return true
 }
 
-// Close closes the badger database.
+func init() {
+	_ = Register("badger", func(ops *Options) (CacheInterface, error) {
+		cache, err := newBadger(ops)
+		if err != nil {
+			return nil, err
+		}
+		return cache, nil
+	})
+}
+
+// newBadger validates ops and returns a Badger cache which owns its database.
+func newBadger(ops *Options) (*BadgerCache, error) {
+	if err := ops.validate("badger"); err != nil {
+		return nil, err
+	}
+
+	var t toolbox.Tools
+	_ = t.CreateDirIfNotExist(ops.BadgerPath)
+	db, err := badger.Open(badger.DefaultOptions(ops.BadgerPath))
+	if err != nil {
+		return nil, err
+	}
+	cache := NewBadgerFromDB(db, ops)
+	cache.KeepOpen = false
+	return cache, nil
+}
+
+// Close closes the badger database, unless KeepOpen is set.
 func (b *BadgerCache) Close() error {
-	return b.Conn.Close()
+	if b.KeepOpen {
+		return nil
+	}
+	return wrapError(b.Conn.Close())
 }
 
 // Get attempts to retrieve a value from the cache.
 func (b *BadgerCache) Get(str string) (any, error) {
+	return b.GetCtx(context.Background(), str)
+}
+
+// GetCtx attempts to retrieve a value from the cache, returning ctx.Err() if ctx is already done.
+func (b *BadgerCache) GetCtx(ctx context.Context, str string) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	var fromCache []byte
 
 	err := b.Conn.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte(str))
+		item, err := txn.Get(b.key(str))
 		if err != nil {
 			return err
 		}
@@ -45,67 +112,101 @@ func (b *BadgerCache) Get(str string) (any, error) {
 		return nil
 	})
 	if err != nil {
-		return nil, err
-	}
-
-	decoded, err := decode(string(fromCache))
-	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 
-	item := decoded[str]
-
-	return item, nil
+	return DecodeValue(fromCache)
 }
 
 // Set puts a value into Badger. The final parameter, expires, is optional.
 func (b *BadgerCache) Set(str string, value any, expires ...time.Duration) error {
-	entry := CacheEntry{}
+	return b.SetCtx(context.Background(), str, value, expires...)
+}
+
+// SetCtx puts a value into Badger, returning ctx.Err() if ctx is already done. The final parameter,
+// expires, is optional.
+func (b *BadgerCache) SetCtx(ctx context.Context, str string, value any, expires ...time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	entry[str] = value
-	encoded, err := encode(entry)
+	encoded, err := EncodeValue(b.Codec, value)
 	if err != nil {
 		return err
 	}
 
 	if len(expires) > 0 {
 		err = b.Conn.Update(func(txn *badger.Txn) error {
-			e := badger.NewEntry([]byte(str), encoded).WithTTL(expires[0])
+			e := badger.NewEntry(b.key(str), encoded).WithTTL(expires[0])
 			err = txn.SetEntry(e)
 			return err
 		})
 	} else {
 		err = b.Conn.Update(func(txn *badger.Txn) error {
-			e := badger.NewEntry([]byte(str), encoded)
+			e := badger.NewEntry(b.key(str), encoded)
 			err = txn.SetEntry(e)
 			return err
 		})
 	}
 
-	return nil
+	return wrapError(err)
+}
+
+// Remember returns the value stored at key. If the key is not in the cache, fn is called to compute
+// the value, which is stored with the given ttl (0 means no expiry) and returned. Concurrent misses
+// for the same key within this process share a single call to fn.
+func (b *BadgerCache) Remember(key string, ttl time.Duration, fn func() (any, error)) (any, error) {
+	return Remember(b, &b.group, key, ttl, fn)
 }
 
 // Forget removes an item from the cache, by key.
 func (b *BadgerCache) Forget(str string) error {
+	return b.ForgetCtx(context.Background(), str)
+}
+
+// ForgetCtx removes an item from the cache, by key, returning ctx.Err() if ctx is already done.
+func (b *BadgerCache) ForgetCtx(ctx context.Context, str string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	err := b.Conn.Update(func(txn *badger.Txn) error {
-		err := txn.Delete([]byte(str))
+		err := txn.Delete(b.key(str))
 		return err
 	})
 
-	return err
+	return wrapError(err)
 }
 
-// EmptyByMatch removes all entries in Redis which have the prefix match.
+// EmptyByMatch removes all entries in Badger which have the prefix match.
 func (b *BadgerCache) EmptyByMatch(str string) error {
-	return b.emptyByMatch(str)
+	return b.emptyByMatch(context.Background(), str)
+}
+
+// EmptyByMatchCtx removes all entries in Badger which have the prefix match. Cancellation of ctx is
+// checked between keys, so a long-running delete stops promptly.
+func (b *BadgerCache) EmptyByMatchCtx(ctx context.Context, str string) error {
+	return b.emptyByMatch(ctx, str)
 }
 
 // Empty removes all entries in Badger.
 func (b *BadgerCache) Empty() error {
-	return b.emptyByMatch("")
+	return b.emptyByMatch(context.Background(), "")
+}
+
+// EmptyCtx removes all entries in Badger, stopping early if ctx is cancelled.
+func (b *BadgerCache) EmptyCtx(ctx context.Context) error {
+	return b.emptyByMatch(ctx, "")
+}
+
+func (b *BadgerCache) emptyByMatch(ctx context.Context, str string) error {
+	return b.deleteMatching(ctx, b.key(str), nil)
 }
 
-func (b *BadgerCache) emptyByMatch(str string) error {
+// deleteMatching deletes every key which starts with prefix, together with the keys which related
+// returns for each of them, if it is not nil. Keys are deleted in batches, so that no transaction
+// grows too large. Locks are never deleted.
+func (b *BadgerCache) deleteMatching(ctx context.Context, prefix []byte, related func(key []byte) [][]byte) error {
 	deleteKeys := func(keysForDelete [][]byte) error {
 		if err := b.Conn.Update(func(txn *badger.Txn) error {
 			for _, key := range keysForDelete {
@@ -121,6 +222,7 @@ func (b *BadgerCache) emptyByMatch(str string) error {
 	}
 
 	collectSize := 100000
+	locks := []byte(b.Prefix + lockSpace)
 
 	err := b.Conn.View(func(txn *badger.Txn) error {
 		opts := badger.DefaultIteratorOptions
@@ -130,20 +232,29 @@ func (b *BadgerCache) emptyByMatch(str string) error {
 		defer it.Close()
 
 		keysForDelete := make([][]byte, 0, collectSize)
-		keysCollected := 0
 
-		for it.Seek([]byte(str)); it.ValidForPrefix([]byte(str)); it.Next() {
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
 			key := it.Item().KeyCopy(nil)
+			if bytes.HasPrefix(key, locks) {
+				continue
+			}
 			keysForDelete = append(keysForDelete, key)
-			keysCollected++
-			if keysCollected == collectSize {
+			if related != nil {
+				keysForDelete = append(keysForDelete, related(key)...)
+			}
+			if len(keysForDelete) >= collectSize {
 				if err := deleteKeys(keysForDelete); err != nil {
 					return err
 				}
+				keysForDelete = keysForDelete[:0]
 			}
 		}
 
-		if keysCollected > 0 {
+		if len(keysForDelete) > 0 {
 			if err := deleteKeys(keysForDelete); err != nil {
 				return err
 			}
@@ -152,35 +263,278 @@ func (b *BadgerCache) emptyByMatch(str string) error {
 		return nil
 	})
 
-	return err
+	return wrapError(err)
 }
 
-// GetInt is a convenience method which retrieves a value from the cache, converts it to an int, and returns it.
-func (b *BadgerCache) GetInt(key string) (int, error) {
-	val, err := b.Get(key)
+// GetMany retrieves several values from Badger in a single transaction. Keys which are not in the
+// cache are omitted from the returned map.
+func (b *BadgerCache) GetMany(keys []string) (map[string]any, error) {
+	result := make(map[string]any, len(keys))
+
+	err := b.Conn.View(func(txn *badger.Txn) error {
+		for _, key := range keys {
+			item, err := txn.Get(b.key(key))
+			if err == badger.ErrKeyNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			decoded, err := DecodeValue(val)
+			if err != nil {
+				return fmt.Errorf("key %s: %w", key, err)
+			}
+			result[key] = decoded
+		}
+		return nil
+	})
 	if err != nil {
-		return 0, err
+		return nil, wrapError(err)
 	}
 
-	return val.(int), nil
+	return result, nil
 }
 
-// GetString is a convenience method which retrieves a value from the cache and returns it as a string.
-func (b *BadgerCache) GetString(key string) (string, error) {
-	s, err := b.Get(key)
+// SetMany puts several values into Badger in a single transaction. The final parameter, expires, is
+// optional, and applies to every item.
+func (b *BadgerCache) SetMany(items map[string]any, expires ...time.Duration) error {
+	entries := make([]*badger.Entry, 0, len(items))
+	for key, value := range items {
+		encoded, err := EncodeValue(b.Codec, value)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", key, err)
+		}
+
+		e := badger.NewEntry(b.key(key), encoded)
+		if len(expires) > 0 {
+			e = e.WithTTL(expires[0])
+		}
+		entries = append(entries, e)
+	}
+
+	err := b.Conn.Update(func(txn *badger.Txn) error {
+		for _, e := range entries {
+			if err := txn.SetEntry(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return wrapError(err)
+}
+
+// ForgetMany removes several items from the cache in a single transaction.
+func (b *BadgerCache) ForgetMany(keys []string) error {
+	err := b.Conn.Update(func(txn *badger.Txn) error {
+		for _, key := range keys {
+			if err := txn.Delete(b.key(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return wrapError(err)
+}
+
+// Increment atomically adds delta to the counter stored at key, and returns the new value. A missing
+// key is treated as 0. The optional ttl is applied only when the counter is created; an existing
+// counter keeps its expiry. Conflicting concurrent updates are retried.
+func (b *BadgerCache) Increment(key string, delta int64, ttl ...time.Duration) (int64, error) {
+	var n int64
+
+	for {
+		err := b.Conn.Update(func(txn *badger.Txn) error {
+			e := badger.NewEntry(b.key(key), nil)
+
+			item, err := txn.Get(b.key(key))
+			switch {
+			case err == badger.ErrKeyNotFound:
+				n = 0
+				if expiration := CounterTTL(ttl); expiration > 0 {
+					e = e.WithTTL(expiration)
+				}
+
+			case err != nil:
+				return err
+
+			default:
+				val, err := item.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				if n, err = ParseCounter(key, val); err != nil {
+					return err
+				}
+				e.ExpiresAt = item.ExpiresAt()
+			}
+
+			n += delta
+			e.Value = FormatCounter(n)
+			return txn.SetEntry(e)
+		})
+		if err == badger.ErrConflict {
+			continue
+		}
+		if err != nil {
+			return 0, wrapError(err)
+		}
+
+		return n, nil
+	}
+}
+
+// Decrement atomically subtracts delta from the counter stored at key, and returns the new value. See
+// Increment.
+func (b *BadgerCache) Decrement(key string, delta int64, ttl ...time.Duration) (int64, error) {
+	return b.Increment(key, -delta, ttl...)
+}
+
+// TTL returns the time remaining before key expires, or NoExpiration if it never expires. Badger
+// records expiry to the second.
+func (b *BadgerCache) TTL(key string) (time.Duration, error) {
+	var expiresAt uint64
+
+	err := b.Conn.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(b.key(key))
+		if err != nil {
+			return err
+		}
+		expiresAt = item.ExpiresAt()
+		return nil
+	})
 	if err != nil {
-		return "", err
+		return 0, wrapError(err)
+	}
+
+	if expiresAt == 0 {
+		return NoExpiration, nil
 	}
-	return s.(string), nil
+	return time.Until(time.Unix(int64(expiresAt), 0)), nil
 }
 
-// GetTime retrieves a value from the cache by the specified key and returns it as time.Time.
-func (b *BadgerCache) GetTime(key string) (time.Time, error) {
-	fromCache, err := b.Get(key)
+// Touch sets the time remaining before key expires to ttl. Badger stores expiry with each value, so
+// the value is rewritten with the new expiry.
+func (b *BadgerCache) Touch(key string, ttl time.Duration) error {
+	return b.setExpiry(key, uint64(time.Now().Add(ttl).Unix()))
+}
+
+// Persist removes the expiry from key, so that it never expires.
+func (b *BadgerCache) Persist(key string) error {
+	return b.setExpiry(key, 0)
+}
+
+// setExpiry rewrites the value stored at key with a new expiry, expressed as a Unix time. Zero means
+// the value never expires.
+func (b *BadgerCache) setExpiry(key string, expiresAt uint64) error {
+	err := b.Conn.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(b.key(key))
+		if err != nil {
+			return err
+		}
+
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		e := badger.NewEntry(b.key(key), val)
+		e.ExpiresAt = expiresAt
+		return txn.SetEntry(e)
+	})
+
+	return wrapError(err)
+}
+
+// MigrateUnprefixed moves keys which were written without a prefix, and which begin with match, into
+// this client's prefix, preserving their expiry. Keys already carrying this client's prefix are left
+// alone, as are locks. Because keys written by other clients cannot be told apart from unprefixed
+// ones, only pass an empty match when this client is the sole user of the database. It returns the
+// number of keys moved.
+func (b *BadgerCache) MigrateUnprefixed(match string) (int, error) {
+	if b.Prefix == "" {
+		return 0, errors.New("migrating keys requires a prefix")
+	}
+
+	own := []byte(b.Prefix + ":")
+	var keys [][]byte
+
+	err := b.Conn.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek([]byte(match)); it.ValidForPrefix([]byte(match)); it.Next() {
+			key := it.Item().KeyCopy(nil)
+			if !bytes.HasPrefix(key, own) && !bytes.Contains(key, []byte(lockSpace)) {
+				keys = append(keys, key)
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return time.Time{}, err
+		return 0, wrapError(err)
 	}
 
-	t := fromCache.(time.Time)
-	return t, nil
+	moved := 0
+	for _, key := range keys {
+		err = b.Conn.Update(func(txn *badger.Txn) error {
+			item, err := txn.Get(key)
+			if err != nil {
+				return err
+			}
+
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			e := badger.NewEntry(b.key(string(key)), val)
+			e.ExpiresAt = item.ExpiresAt()
+			if err := txn.SetEntry(e); err != nil {
+				return err
+			}
+			return txn.Delete(key)
+		})
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return moved, wrapError(err)
+		}
+		moved++
+	}
+
+	return moved, nil
+}
+
+// key returns the key as stored in Badger, including this client's prefix.
+func (b *BadgerCache) key(str string) []byte {
+	if b.Prefix == "" {
+		return []byte(str)
+	}
+	return []byte(b.Prefix + ":" + str)
+}
+
+// GetInt is a convenience method which retrieves a value from the cache, converts it to an int, and returns it.
+func (b *BadgerCache) GetInt(key string) (int, error) {
+	return GetInt(b, key)
+}
+
+// GetString is a convenience method which retrieves a value from the cache and returns it as a string.
+func (b *BadgerCache) GetString(key string) (string, error) {
+	return GetAs[string](b, key)
+}
+
+// GetTime retrieves a value from the cache by the specified key and returns it as time.Time.
+func (b *BadgerCache) GetTime(key string) (time.Time, error) {
+	return GetAs[time.Time](b, key)
 }
@@ -1,7 +1,11 @@
 package remember
 
 import (
+	"context"
 	"encoding/gob"
+	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -292,6 +296,316 @@ func TestBadgerCache_GetTime(t *testing.T) {
 	testBadgerCache.Empty()
 }
 
+func TestBadgerCache_Remember(t *testing.T) {
+	var calls int32
+	loader := func() (any, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		return "computed", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			x, err := testBadgerCache.Remember("remembered", time.Minute, loader)
+			if err != nil {
+				t.Error(err)
+			}
+			if x != "computed" {
+				t.Error("wrong value returned from Remember:", x)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("expected loader to be called once, but it was called %d times", calls)
+	}
+
+	x, err := testBadgerCache.Get("remembered")
+	if err != nil {
+		t.Error(err)
+	}
+	if x != "computed" {
+		t.Error("value from Remember was not stored in the cache")
+	}
+
+	_, err = testBadgerCache.Remember("failed", time.Minute, func() (any, error) {
+		return nil, errors.New("boom")
+	})
+	if err == nil {
+		t.Error("expected error from loader but did not get one")
+	}
+	if testBadgerCache.Has("failed") {
+		t.Error("failed load should not be stored in the cache")
+	}
+
+	testBadgerCache.Empty()
+}
+
+func TestBadgerCache_Context(t *testing.T) {
+	c, ok := testBadgerCache.(ContextCacheInterface)
+	if !ok {
+		t.Fatal("cache does not implement ContextCacheInterface")
+	}
+
+	ctx := context.Background()
+	err := c.SetCtx(ctx, "ctxkey", "ctxval")
+	if err != nil {
+		t.Error(err)
+	}
+
+	x, err := c.GetCtx(ctx, "ctxkey")
+	if err != nil {
+		t.Error(err)
+	}
+	if x != "ctxval" {
+		t.Error("wrong value retrieved from cache:", x)
+	}
+
+	if !c.HasCtx(ctx, "ctxkey") {
+		t.Error("ctxkey should be in the cache")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if err := c.SetCtx(cancelled, "ctxkey2", "ctxval"); !errors.Is(err, context.Canceled) {
+		t.Error("expected context.Canceled from SetCtx, got", err)
+	}
+
+	if err := c.EmptyByMatchCtx(cancelled, "ctx"); !errors.Is(err, context.Canceled) {
+		t.Error("expected context.Canceled from EmptyByMatchCtx, got", err)
+	}
+
+	if !c.Has("ctxkey") {
+		t.Error("cancelled EmptyByMatchCtx should not have removed ctxkey")
+	}
+
+	if err := c.ForgetCtx(ctx, "ctxkey"); err != nil {
+		t.Error(err)
+	}
+	if c.HasCtx(ctx, "ctxkey") {
+		t.Error("ctxkey should have been removed from the cache")
+	}
+
+	if err := c.EmptyCtx(ctx); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBadgerCache_Prefix(t *testing.T) {
+	conn := testBadgerCache.(*BadgerCache).Conn
+	app1 := &BadgerCache{Conn: conn, Prefix: "app1"}
+	app2 := &BadgerCache{Conn: conn, Prefix: "app2"}
+
+	_ = app1.Set("shared", "one")
+	_ = app2.Set("shared", "two")
+	_ = testBadgerCache.Set("legacy", "three")
+
+	x, _ := app1.Get("shared")
+	y, _ := app2.Get("shared")
+	if x != "one" || y != "two" {
+		t.Errorf("prefixed clients should not see each other's values; got %v and %v", x, y)
+	}
+
+	err := app1.Empty()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if app1.Has("shared") {
+		t.Error("app1 should be empty")
+	}
+	if !app2.Has("shared") {
+		t.Error("emptying app1 removed a key belonging to app2")
+	}
+	if !testBadgerCache.Has("legacy") {
+		t.Error("emptying app1 removed an unprefixed key")
+	}
+
+	moved, err := app1.MigrateUnprefixed("leg")
+	if err != nil {
+		t.Error(err)
+	}
+	if moved != 1 {
+		t.Errorf("expected to migrate 1 key, migrated %d", moved)
+	}
+	if testBadgerCache.Has("legacy") {
+		t.Error("migrated key should no longer exist without a prefix")
+	}
+	x, _ = app1.Get("legacy")
+	if x != "three" {
+		t.Error("migrated key has wrong value:", x)
+	}
+
+	_, err = testBadgerCache.(*BadgerCache).MigrateUnprefixed("")
+	if err == nil {
+		t.Error("expected error migrating without a prefix")
+	}
+
+	_ = app1.Empty()
+	_ = app2.Empty()
+}
+
+func TestBadgerCache_Many(t *testing.T) {
+	items := map[string]any{
+		"many1": "one",
+		"many2": 2,
+		"many3": "three",
+	}
+
+	err := testBadgerCache.SetMany(items, time.Minute)
+	if err != nil {
+		t.Error(err)
+	}
+
+	found, err := testBadgerCache.GetMany([]string{"many1", "many2", "many3", "missing"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(found) != 3 {
+		t.Errorf("expected 3 values, got %d", len(found))
+	}
+	for k, v := range items {
+		if found[k] != v {
+			t.Errorf("wrong value for %s; expected %v but got %v", k, v, found[k])
+		}
+	}
+	if _, ok := found["missing"]; ok {
+		t.Error("missing key should not be in the result")
+	}
+
+	err = testBadgerCache.ForgetMany([]string{"many1", "many2", "missing"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if testBadgerCache.Has("many1") || testBadgerCache.Has("many2") {
+		t.Error("ForgetMany did not remove keys")
+	}
+	if !testBadgerCache.Has("many3") {
+		t.Error("ForgetMany removed a key it was not given")
+	}
+
+	found, err = testBadgerCache.GetMany(nil)
+	if err != nil || len(found) != 0 {
+		t.Error("expected an empty result for no keys")
+	}
+
+	testBadgerCache.Empty()
+}
+
+func TestBadgerCache_Increment(t *testing.T) {
+	n, err := testBadgerCache.Increment("counter", 5, time.Minute)
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 5 {
+		t.Errorf("expected 5, got %d", n)
+	}
+
+	n, err = testBadgerCache.Decrement("counter", 2)
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 3 {
+		t.Errorf("expected 3, got %d", n)
+	}
+
+	i, err := testBadgerCache.GetInt("counter")
+	if err != nil {
+		t.Error(err)
+	}
+	if i != 3 {
+		t.Errorf("expected GetInt to return 3, got %d", i)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := testBadgerCache.Increment("counter", 1); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	x, err := testBadgerCache.Get("counter")
+	if err != nil {
+		t.Error(err)
+	}
+	if x != int64(23) {
+		t.Errorf("expected 23 after concurrent increments, got %v", x)
+	}
+
+	_ = testBadgerCache.Set("notcounter", "bar")
+	_, err = testBadgerCache.Increment("notcounter", 1)
+	if !errors.Is(err, ErrNotInteger) {
+		t.Error("expected ErrNotInteger, got", err)
+	}
+
+	testBadgerCache.Empty()
+}
+
+func TestBadgerCache_TTL(t *testing.T) {
+	_ = testBadgerCache.Set("ttl", "x", time.Hour)
+
+	ttl, err := testBadgerCache.TTL("ttl")
+	if err != nil {
+		t.Error(err)
+	}
+	if ttl < time.Hour-5*time.Second || ttl > time.Hour {
+		t.Errorf("expected ttl of about an hour, got %s", ttl)
+	}
+
+	err = testBadgerCache.Touch("ttl", 2*time.Hour)
+	if err != nil {
+		t.Error(err)
+	}
+	ttl, _ = testBadgerCache.TTL("ttl")
+	if ttl < 2*time.Hour-5*time.Second || ttl > 2*time.Hour {
+		t.Errorf("expected ttl of about two hours after Touch, got %s", ttl)
+	}
+
+	err = testBadgerCache.Persist("ttl")
+	if err != nil {
+		t.Error(err)
+	}
+	ttl, _ = testBadgerCache.TTL("ttl")
+	if ttl != NoExpiration {
+		t.Errorf("expected NoExpiration after Persist, got %s", ttl)
+	}
+
+	x, _ := testBadgerCache.Get("ttl")
+	if x != "x" {
+		t.Error("value changed by Touch or Persist:", x)
+	}
+
+	_, _ = testBadgerCache.Increment("ttlcounter", 1, time.Minute)
+	ttl, _ = testBadgerCache.TTL("ttlcounter")
+	if ttl <= 0 || ttl > time.Minute {
+		t.Errorf("expected new counter to expire within a minute, got %s", ttl)
+	}
+
+	if _, err := testBadgerCache.TTL("missing"); !errors.Is(err, ErrNotFound) {
+		t.Error("expected ErrNotFound from TTL, got", err)
+	}
+	if err := testBadgerCache.Touch("missing", time.Minute); !errors.Is(err, ErrNotFound) {
+		t.Error("expected ErrNotFound from Touch, got", err)
+	}
+	if err := testBadgerCache.Persist("missing"); !errors.Is(err, ErrNotFound) {
+		t.Error("expected ErrNotFound from Persist, got", err)
+	}
+
+	testBadgerCache.Empty()
+}
+
 func TestBadgerCache_Close(t *testing.T) {
 	err := testBadgerCache.Close()
 	if err != nil {
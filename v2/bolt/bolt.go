@@ -0,0 +1,547 @@
+// Package bolt provides a remember cache kept in a single bbolt (BoltDB) file. Importing it registers
+// the "bolt" cache type with remember.New.
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"github.com/tsawler/remember/v2"
+	"github.com/tsawler/toolbox"
+	"go.etcd.io/bbolt"
+	"golang.org/x/sync/singleflight"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// Cache is the type for a bbolt (BoltDB) cache, kept in a single file. Each prefix has its own bucket,
+// so Empty drops a bucket and EmptyByMatch walks only the matching range of keys. Bolt has no expiry
+// of its own, so every value is stored after its expiry time, and expired entries are removed when
+// they are read and periodically in the background.
+type Cache struct {
+	Conn     *bbolt.DB
+	Prefix   string
+	Codec    remember.Codec // The codec used to serialize values. Defaults to remember.GobCodec.
+	KeepOpen bool           // If true, Close leaves Conn open, for databases owned by the caller.
+	group    singleflight.Group
+	done     chan struct{}
+	closed   atomic.Bool
+}
+
+const (
+	// defaultPath is the database file used when Options.BoltPath is not set.
+	defaultPath = "./bolt.db"
+
+	// defaultBucket is the bucket used when Prefix is empty.
+	defaultBucket = "remember"
+
+	// purgeInterval is how often expired entries are removed in the background.
+	purgeInterval = time.Minute
+
+	// headerSize is the length of the expiry stored in front of every value.
+	headerSize = 8
+)
+
+func init() {
+	_ = remember.Register("bolt", func(ops *remember.Options) (remember.CacheInterface, error) {
+		cache, err := newCache(ops)
+		if err != nil {
+			return nil, err
+		}
+		return cache, nil
+	})
+}
+
+// New returns a bbolt cache configured by opts. The database is stored in ./bolt.db unless WithPath is
+// given.
+func New(opts ...remember.Option) (*Cache, error) {
+	ops := &remember.Options{}
+	for _, opt := range opts {
+		opt(ops)
+	}
+	return newCache(ops)
+}
+
+// WithPath sets the bbolt database file.
+func WithPath(path string) remember.Option {
+	return func(o *remember.Options) { o.BoltPath = path }
+}
+
+// newCache returns a bolt cache which owns its database, stored in ./bolt.db unless ops sets BoltPath.
+// Opening gives up after a second if another process holds the file.
+func newCache(o *remember.Options) (*Cache, error) {
+	ops := *o
+	if ops.BoltPath == "" {
+		ops.BoltPath = defaultPath
+	}
+
+	var t toolbox.Tools
+	_ = t.CreateDirIfNotExist(filepath.Dir(ops.BoltPath))
+	db, err := bbolt.Open(ops.BoltPath, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	cache, err := NewFromDB(db, &ops)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	cache.KeepOpen = false
+	return cache, nil
+}
+
+// NewFromDB returns a cache which uses an existing bbolt database, taking Prefix and Codec from the
+// optional options. The prefix's bucket is created if it does not exist. Close leaves the database open
+// unless KeepOpen is set to false.
+func NewFromDB(db *bbolt.DB, o ...*remember.Options) (*Cache, error) {
+	ops := &remember.Options{}
+	if len(o) > 0 && o[0] != nil {
+		ops = o[0]
+	}
+	b := &Cache{
+		Conn:     db,
+		Prefix:   ops.Prefix,
+		Codec:    ops.Codec,
+		KeepOpen: true,
+		done:     make(chan struct{}),
+	}
+
+	err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(b.bucket())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go b.janitor()
+
+	return b, nil
+}
+
+// janitor removes expired entries every purgeInterval until the cache is closed.
+func (b *Cache) janitor() {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+			_ = b.Purge()
+		}
+	}
+}
+
+// Purge removes every expired entry in the prefix's bucket. It is called periodically, so there is
+// normally no need to call it directly.
+func (b *Cache) Purge() error {
+	if b.closed.Load() {
+		return remember.ErrClosed
+	}
+
+	now := time.Now()
+	return b.Conn.Update(func(tx *bbolt.Tx) error {
+		var expired [][]byte
+		c := b.cursor(tx)
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if expiresAt, _ := splitStoredValue(v); hasExpired(expiresAt, now) {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+		}
+
+		bucket := tx.Bucket(b.bucket())
+		for _, k := range expired {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Close stops the background purge and closes the database, unless KeepOpen is set. Any later
+// operation returns remember.ErrClosed.
+func (b *Cache) Close() error {
+	if !b.closed.CompareAndSwap(false, true) {
+		return remember.ErrClosed
+	}
+	close(b.done)
+
+	if b.KeepOpen {
+		return nil
+	}
+	return b.Conn.Close()
+}
+
+// Has checks to see if the supplied key is in the cache and returns true if found, otherwise false.
+func (b *Cache) Has(key string) bool {
+	_, err := b.Get(key)
+	return err == nil
+}
+
+// Get attempts to retrieve a value from the cache. An expired entry is removed, and reported as
+// remember.ErrExpired.
+func (b *Cache) Get(key string) (any, error) {
+	var data []byte
+	err := b.view(func(tx *bbolt.Tx) error {
+		_, payload, err := b.lookup(tx, key)
+		if err != nil {
+			return err
+		}
+		data = append([]byte(nil), payload...)
+		return nil
+	})
+	if errors.Is(err, remember.ErrExpired) {
+		_ = b.removeExpired(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return remember.DecodeValue(data)
+}
+
+// Set puts a value into the cache. The final parameter, expires, is optional.
+func (b *Cache) Set(key string, value any, expires ...time.Duration) error {
+	return b.SetMany(map[string]any{key: value}, expires...)
+}
+
+// Remember returns the value stored at key. If the key is not in the cache, fn is called to compute
+// the value, which is stored with the given ttl (0 means no expiry) and returned. Concurrent misses
+// for the same key share a single call to fn.
+func (b *Cache) Remember(key string, ttl time.Duration, fn func() (any, error)) (any, error) {
+	return remember.Remember(b, &b.group, key, ttl, fn)
+}
+
+// Forget removes an item from the cache, by key.
+func (b *Cache) Forget(key string) error {
+	return b.ForgetMany([]string{key})
+}
+
+// GetMany retrieves several values from the cache in a single read transaction. Keys which are not in
+// the cache are omitted from the returned map.
+func (b *Cache) GetMany(keys []string) (map[string]any, error) {
+	found := make(map[string][]byte, len(keys))
+	err := b.view(func(tx *bbolt.Tx) error {
+		for _, key := range keys {
+			_, payload, err := b.lookup(tx, key)
+			if errors.Is(err, remember.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			found[key] = append([]byte(nil), payload...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]any, len(found))
+	for key, data := range found {
+		val, err := remember.DecodeValue(data)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = val
+	}
+	return result, nil
+}
+
+// SetMany puts several values into the cache in a single transaction. The final parameter, expires, is
+// optional, and applies to every item.
+func (b *Cache) SetMany(items map[string]any, expires ...time.Duration) error {
+	var expiresAt time.Time
+	if len(expires) > 0 && expires[0] > 0 {
+		expiresAt = time.Now().Add(expires[0])
+	}
+
+	encoded := make(map[string][]byte, len(items))
+	for key, value := range items {
+		data, err := remember.EncodeValue(b.Codec, value)
+		if err != nil {
+			return err
+		}
+		encoded[key] = data
+	}
+
+	return b.update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(b.bucket())
+		for key, data := range encoded {
+			if err := bucket.Put([]byte(key), storedValue(expiresAt, data)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ForgetMany removes several items from the cache in a single transaction.
+func (b *Cache) ForgetMany(keys []string) error {
+	return b.update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(b.bucket())
+		for _, key := range keys {
+			if err := bucket.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// EmptyByMatch removes all entries in the cache which have the prefix match. Keys in a bucket are
+// sorted, so only the matching range is visited.
+func (b *Cache) EmptyByMatch(match string) error {
+	if match == "" {
+		return b.Empty()
+	}
+
+	prefix := []byte(match)
+	return b.update(func(tx *bbolt.Tx) error {
+		c := b.cursor(tx)
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Seek(prefix) {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Empty removes all entries in the cache, by replacing the prefix's bucket with an empty one.
+func (b *Cache) Empty() error {
+	return b.update(func(tx *bbolt.Tx) error {
+		if err := tx.DeleteBucket(b.bucket()); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(b.bucket())
+		return err
+	})
+}
+
+// GetCtx attempts to retrieve a value from the cache, returning ctx.Err() if ctx is already done.
+func (b *Cache) GetCtx(ctx context.Context, key string) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return b.Get(key)
+}
+
+// HasCtx checks for existence of item in cache, returning false if ctx is already done.
+func (b *Cache) HasCtx(ctx context.Context, key string) bool {
+	return ctx.Err() == nil && b.Has(key)
+}
+
+// SetCtx puts a value into the cache, returning ctx.Err() if ctx is already done. The final
+// parameter, expires, is optional.
+func (b *Cache) SetCtx(ctx context.Context, key string, value any, expires ...time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.Set(key, value, expires...)
+}
+
+// ForgetCtx removes an item from the cache, by key, returning ctx.Err() if ctx is already done.
+func (b *Cache) ForgetCtx(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.Forget(key)
+}
+
+// EmptyByMatchCtx removes all entries in the cache which have the prefix match, returning ctx.Err()
+// if ctx is already done.
+func (b *Cache) EmptyByMatchCtx(ctx context.Context, match string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.EmptyByMatch(match)
+}
+
+// EmptyCtx removes all entries from the cache, returning ctx.Err() if ctx is already done.
+func (b *Cache) EmptyCtx(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.Empty()
+}
+
+// Increment atomically adds delta to the int64 counter stored at key, and returns the new value. A
+// missing key is treated as 0. The optional ttl is applied only when the counter is created; an
+// existing counter keeps its expiry.
+func (b *Cache) Increment(key string, delta int64, ttl ...time.Duration) (int64, error) {
+	var n int64
+	err := b.update(func(tx *bbolt.Tx) error {
+		expiresAt, payload, err := b.lookup(tx, key)
+		switch {
+		case err == nil:
+			if n, err = remember.ParseCounter(key, payload); err != nil {
+				return err
+			}
+
+		case errors.Is(err, remember.ErrNotFound):
+			n, expiresAt = 0, time.Time{}
+			if t := remember.CounterTTL(ttl); t > 0 {
+				expiresAt = time.Now().Add(t)
+			}
+
+		default:
+			return err
+		}
+
+		n += delta
+		return tx.Bucket(b.bucket()).Put([]byte(key), storedValue(expiresAt, remember.FormatCounter(n)))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Decrement atomically subtracts delta from the counter stored at key, and returns the new value. See
+// Increment.
+func (b *Cache) Decrement(key string, delta int64, ttl ...time.Duration) (int64, error) {
+	return b.Increment(key, -delta, ttl...)
+}
+
+// TTL returns the time remaining before key expires, or remember.NoExpiration if it never expires.
+func (b *Cache) TTL(key string) (time.Duration, error) {
+	var expiresAt time.Time
+	err := b.view(func(tx *bbolt.Tx) error {
+		var err error
+		expiresAt, _, err = b.lookup(tx, key)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if expiresAt.IsZero() {
+		return remember.NoExpiration, nil
+	}
+	return time.Until(expiresAt), nil
+}
+
+// Touch sets the time remaining before key expires to ttl.
+func (b *Cache) Touch(key string, ttl time.Duration) error {
+	return b.setExpiry(key, time.Now().Add(ttl))
+}
+
+// Persist removes the expiry from key, so that it never expires.
+func (b *Cache) Persist(key string) error {
+	return b.setExpiry(key, time.Time{})
+}
+
+// setExpiry rewrites the value stored at key with a new expiry. The zero time means the value never
+// expires.
+func (b *Cache) setExpiry(key string, expiresAt time.Time) error {
+	return b.update(func(tx *bbolt.Tx) error {
+		_, payload, err := b.lookup(tx, key)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(b.bucket()).Put([]byte(key), storedValue(expiresAt, payload))
+	})
+}
+
+// GetInt is a convenience method which retrieves a value from the cache, converts it to an int, and returns it.
+func (b *Cache) GetInt(key string) (int, error) {
+	return remember.GetInt(b, key)
+}
+
+// GetString is a convenience method which retrieves a value from the cache and returns it as a string.
+func (b *Cache) GetString(key string) (string, error) {
+	return remember.GetAs[string](b, key)
+}
+
+// GetTime retrieves a value from the cache by the specified key and returns it as time.Time.
+func (b *Cache) GetTime(key string) (time.Time, error) {
+	return remember.GetAs[time.Time](b, key)
+}
+
+// lookup returns the expiry and payload of the live entry at key. The payload is only valid for the
+// life of tx.
+func (b *Cache) lookup(tx *bbolt.Tx, key string) (time.Time, []byte, error) {
+	v := tx.Bucket(b.bucket()).Get([]byte(key))
+	if v == nil {
+		return time.Time{}, nil, remember.ErrNotFound
+	}
+
+	expiresAt, payload := splitStoredValue(v)
+	if hasExpired(expiresAt, time.Now()) {
+		return time.Time{}, nil, remember.ErrExpired
+	}
+	return expiresAt, payload, nil
+}
+
+// removeExpired deletes the entry at key if it is still expired, so that a value written since it was
+// found to have expired is left alone.
+func (b *Cache) removeExpired(key string) error {
+	return b.update(func(tx *bbolt.Tx) error {
+		if _, _, err := b.lookup(tx, key); !errors.Is(err, remember.ErrExpired) {
+			return nil
+		}
+		return tx.Bucket(b.bucket()).Delete([]byte(key))
+	})
+}
+
+// view runs fn in a read-only transaction, unless the cache is closed.
+func (b *Cache) view(fn func(*bbolt.Tx) error) error {
+	if b.closed.Load() {
+		return remember.ErrClosed
+	}
+	return b.Conn.View(fn)
+}
+
+// update runs fn in a read-write transaction, unless the cache is closed.
+func (b *Cache) update(fn func(*bbolt.Tx) error) error {
+	if b.closed.Load() {
+		return remember.ErrClosed
+	}
+	return b.Conn.Update(fn)
+}
+
+// cursor returns a cursor over the prefix's bucket.
+func (b *Cache) cursor(tx *bbolt.Tx) *bbolt.Cursor {
+	return tx.Bucket(b.bucket()).Cursor()
+}
+
+// bucket returns the name of the bucket holding this client's keys.
+func (b *Cache) bucket() []byte {
+	if b.Prefix == "" {
+		return []byte(defaultBucket)
+	}
+	return []byte(b.Prefix)
+}
+
+// storedValue puts the expiry, as Unix nanoseconds with zero meaning none, in front of payload.
+func storedValue(expiresAt time.Time, payload []byte) []byte {
+	value := make([]byte, headerSize, headerSize+len(payload))
+	if !expiresAt.IsZero() {
+		binary.BigEndian.PutUint64(value, uint64(expiresAt.UnixNano()))
+	}
+	return append(value, payload...)
+}
+
+// splitStoredValue separates a stored value into its expiry and payload.
+func splitStoredValue(v []byte) (time.Time, []byte) {
+	if len(v) < headerSize {
+		return time.Time{}, v
+	}
+
+	var expiresAt time.Time
+	if nanos := binary.BigEndian.Uint64(v); nanos != 0 {
+		expiresAt = time.Unix(0, int64(nanos))
+	}
+	return expiresAt, v[headerSize:]
+}
+
+// hasExpired reports whether an entry with the given expiry has expired at now.
+func hasExpired(expiresAt, now time.Time) bool {
+	return !expiresAt.IsZero() && !now.Before(expiresAt)
+}
@@ -0,0 +1,59 @@
+package bolt
+
+import (
+	"errors"
+	"github.com/tsawler/remember/v2"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// newTestCache returns a Cache stored in a temporary file.
+func newTestCache(t *testing.T, prefix string) *Cache {
+	t.Helper()
+
+	cache, err := New(WithPath(filepath.Join(t.TempDir(), "cache.db")), remember.WithPrefix(prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = cache.Close() })
+	return cache
+}
+
+func TestNew(t *testing.T) {
+	cache, err := remember.New("bolt", &remember.Options{BoltPath: filepath.Join(t.TempDir(), "cache.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+}
+
+func TestCache_Purge(t *testing.T) {
+	cache := newTestCache(t, "test")
+
+	_ = cache.Set("lazy", "value", 10*time.Millisecond)
+	_ = cache.Set("purged", "value", 10*time.Millisecond)
+	_ = cache.Set("kept", "value")
+	time.Sleep(15 * time.Millisecond)
+
+	_, err := cache.Get("lazy")
+	if !errors.Is(err, remember.ErrExpired) {
+		t.Error("expected ErrExpired, got", err)
+	}
+
+	err = cache.Purge()
+	if err != nil {
+		t.Error(err)
+	}
+
+	n := 0
+	_ = cache.Conn.View(func(tx *bbolt.Tx) error {
+		n = tx.Bucket([]byte("test")).Stats().KeyN
+		return nil
+	})
+	if n != 1 {
+		t.Error("expected expired entries to be removed, leaving 1, got", n)
+	}
+}
@@ -0,0 +1,92 @@
+package remember
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/redis/go-redis/v9"
+	"github.com/tidwall/buntdb"
+)
+
+func TestNewRedisFromClient(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: testRedis.Addr()})
+	defer client.Close()
+
+	cache := NewRedisFromClient(client, &Options{Prefix: "borrowed"})
+	err := cache.Set("foo", "bar")
+	if err != nil {
+		t.Error(err)
+	}
+	if _, err := client.Get(context.Background(), "borrowed:foo").Result(); err != nil {
+		t.Error("expected key to be written with prefix:", err)
+	}
+
+	err = cache.Close()
+	if err != nil {
+		t.Error(err)
+	}
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		t.Error("expected client to be left open:", err)
+	}
+
+	cache.KeepOpen = false
+	_ = cache.Close()
+	if err := client.Ping(context.Background()).Err(); err == nil {
+		t.Error("expected client to be closed when KeepOpen is false")
+	}
+}
+
+func TestNewBadgerFromDB(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("./testdata/badger_borrowed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	cache := NewBadgerFromDB(db, &Options{Prefix: "borrowed"})
+	err = cache.Set("foo", "bar")
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = cache.Close()
+	if err != nil {
+		t.Error(err)
+	}
+	if db.IsClosed() {
+		t.Error("expected database to be left open")
+	}
+
+	other := NewBadgerFromDB(db, &Options{Prefix: "borrowed"})
+	val, err := other.GetString("foo")
+	if err != nil || val != "bar" {
+		t.Error("expected value written through borrowed database, got", val, err)
+	}
+}
+
+func TestNewBuntDBFromDB(t *testing.T) {
+	db, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	cache := NewBuntDBFromDB(db)
+	err = cache.Set("foo", "bar")
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = cache.Close()
+	if err != nil {
+		t.Error(err)
+	}
+	err = db.View(func(tx *buntdb.Tx) error {
+		_, err := tx.Get("foo")
+		return err
+	})
+	if err != nil {
+		t.Error("expected database to be left open:", err)
+	}
+}
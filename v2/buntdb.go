@@ -1,22 +1,51 @@
 package remember
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/tidwall/buntdb"
-	"log"
+	"golang.org/x/sync/singleflight"
 	"strings"
 	"time"
 )
 
-// BuntDBCache is the type for a BuntDB cache.
+// BuntDBCache is the type for a BuntDB cache. When Prefix is set, every key is stored as "prefix:key",
+// so that Empty and EmptyByMatch only touch this client's keys even when several clients share one
+// database. With an empty Prefix, keys are stored as given.
 type BuntDBCache struct {
-	Conn   *buntdb.DB
-	Prefix string
+	Conn     *buntdb.DB
+	Prefix   string
+	Codec    Codec // The codec used to serialize values. Defaults to GobCodec.
+	KeepOpen bool  // If true, Close leaves Conn open, for databases owned by the caller.
+	group    singleflight.Group
+}
+
+// NewBuntDBFromDB returns a cache which uses an existing BuntDB database, taking Prefix and Codec
+// from the optional options. Close leaves the database open unless KeepOpen is set to false.
+func NewBuntDBFromDB(db *buntdb.DB, o ...*Options) *BuntDBCache {
+	ops := firstOptions(o)
+	return &BuntDBCache{
+		Conn:     db,
+		Prefix:   ops.Prefix,
+		Codec:    ops.Codec,
+		KeepOpen: true,
+	}
 }
 
 // Has checks to see if the supplied key is in the cache and returns true if found, otherwise false.
 func (b *BuntDBCache) Has(str string) bool {
+	return b.HasCtx(context.Background(), str)
+}
+
+// HasCtx checks to see if the supplied key is in the cache, returning false if ctx is already done.
+func (b *BuntDBCache) HasCtx(ctx context.Context, str string) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
 	err := b.Conn.View(func(tx *buntdb.Tx) error {
-		_, err := tx.Get(str)
+		_, err := tx.Get(b.key(str))
 		if err != nil {
 			return err
 		}
@@ -28,17 +57,54 @@ func (b *BuntDBCache) Has(str string) bool {
 	return true
 }
 
-// Close closes the badger database.
+func init() {
+	_ = Register("buntdb", func(ops *Options) (CacheInterface, error) {
+		cache, err := newBuntDB(ops)
+		if err != nil {
+			return nil, err
+		}
+		return cache, nil
+	})
+}
+
+// newBuntDB validates ops and returns a BuntDB cache which owns its database.
+func newBuntDB(ops *Options) (*BuntDBCache, error) {
+	if err := ops.validate("buntdb"); err != nil {
+		return nil, err
+	}
+
+	db, err := buntdb.Open(ops.BuntDBPath)
+	if err != nil {
+		return nil, err
+	}
+	cache := NewBuntDBFromDB(db, ops)
+	cache.KeepOpen = false
+	return cache, nil
+}
+
+// Close closes the BuntDB database, unless KeepOpen is set.
 func (b *BuntDBCache) Close() error {
-	return b.Conn.Close()
+	if b.KeepOpen {
+		return nil
+	}
+	return wrapError(b.Conn.Close())
 }
 
 // Get attempts to retrieve a value from the cache.
 func (b *BuntDBCache) Get(str string) (any, error) {
+	return b.GetCtx(context.Background(), str)
+}
+
+// GetCtx attempts to retrieve a value from the cache, returning ctx.Err() if ctx is already done.
+func (b *BuntDBCache) GetCtx(ctx context.Context, str string) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	var fromCache string
 
 	err := b.Conn.View(func(txn *buntdb.Tx) error {
-		item, err := txn.Get(str)
+		item, err := txn.Get(b.key(str))
 		if err != nil {
 			return err
 		}
@@ -47,25 +113,25 @@ func (b *BuntDBCache) Get(str string) (any, error) {
 		return nil
 	})
 	if err != nil {
-		return nil, err
-	}
-
-	decoded, err := decode(fromCache)
-	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 
-	item := decoded[str]
-
-	return item, nil
+	return DecodeValue([]byte(fromCache))
 }
 
 // Set puts a value into BuntDB. The final parameter, expires, is optional.
 func (b *BuntDBCache) Set(str string, value any, expires ...time.Duration) error {
-	entry := CacheEntry{}
+	return b.SetCtx(context.Background(), str, value, expires...)
+}
 
-	entry[str] = value
-	encoded, err := encode(entry)
+// SetCtx puts a value into BuntDB, returning ctx.Err() if ctx is already done. The final parameter,
+// expires, is optional.
+func (b *BuntDBCache) SetCtx(ctx context.Context, str string, value any, expires ...time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	encoded, err := EncodeValue(b.Codec, value)
 	if err != nil {
 		return err
 	}
@@ -79,86 +145,350 @@ func (b *BuntDBCache) Set(str string, value any, expires ...time.Duration) error
 	}
 
 	err = b.Conn.Update(func(tx *buntdb.Tx) error {
-		_, _, err := tx.Set(str, string(encoded), so)
+		_, _, err := tx.Set(b.key(str), string(encoded), so)
 		return err
 	})
 	if err != nil {
-		return err
+		return wrapError(err)
 	}
 
 	return nil
 }
 
+// Remember returns the value stored at key. If the key is not in the cache, fn is called to compute
+// the value, which is stored with the given ttl (0 means no expiry) and returned. Concurrent misses
+// for the same key within this process share a single call to fn.
+func (b *BuntDBCache) Remember(key string, ttl time.Duration, fn func() (any, error)) (any, error) {
+	return Remember(b, &b.group, key, ttl, fn)
+}
+
 // Forget removes an item from the cache, by key.
 func (b *BuntDBCache) Forget(str string) error {
+	return b.ForgetCtx(context.Background(), str)
+}
+
+// ForgetCtx removes an item from the cache, by key, returning ctx.Err() if ctx is already done.
+func (b *BuntDBCache) ForgetCtx(ctx context.Context, str string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	err := b.Conn.Update(func(tx *buntdb.Tx) error {
-		_, err := tx.Delete(str)
+		_, err := tx.Delete(b.key(str))
+		if err == buntdb.ErrNotFound {
+			return nil
+		}
 		return err
 	})
-	return err
+	return wrapError(err)
 }
 
-// EmptyByMatch removes all entries in Redis which have the prefix match.
+// EmptyByMatch removes all entries in BuntDB which have the prefix match.
 func (b *BuntDBCache) EmptyByMatch(str string) error {
-	return b.emptyByMatch(str)
+	return b.emptyByMatch(context.Background(), str)
 }
 
-// Empty removes all entries in Badger.
+// EmptyByMatchCtx removes all entries in BuntDB which have the prefix match. Cancellation of ctx is
+// checked between keys, so a long-running delete stops promptly.
+func (b *BuntDBCache) EmptyByMatchCtx(ctx context.Context, str string) error {
+	return b.emptyByMatch(ctx, str)
+}
+
+// Empty removes all entries in BuntDB.
 func (b *BuntDBCache) Empty() error {
-	return b.emptyByMatch("")
+	return b.emptyByMatch(context.Background(), "")
+}
+
+// EmptyCtx removes all entries in BuntDB, stopping early if ctx is cancelled.
+func (b *BuntDBCache) EmptyCtx(ctx context.Context) error {
+	return b.emptyByMatch(ctx, "")
 }
 
-func (b *BuntDBCache) emptyByMatch(str string) error {
+func (b *BuntDBCache) emptyByMatch(ctx context.Context, str string) error {
 	var delkeys []string
+	prefix := b.key(str)
+	locks := b.Prefix + lockSpace
 	err := b.Conn.View(func(tx *buntdb.Tx) error {
-		err := tx.Ascend("", func(key, value string) bool {
-			log.Println("key:", key)
-			if strings.HasPrefix(key, str) {
+		err := tx.AscendGreaterOrEqual("", prefix, func(key, value string) bool {
+			if ctx.Err() != nil || !strings.HasPrefix(key, prefix) {
+				return false
+			}
+			if !strings.HasPrefix(key, locks) {
 				delkeys = append(delkeys, key)
 			}
 			return true
 		})
 		return err
 	})
+	if err != nil {
+		return wrapError(err)
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
 
 	err = b.Conn.Update(func(tx *buntdb.Tx) error {
 		for _, k := range delkeys {
-			if _, err = tx.Delete(k); err != nil {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if _, err := tx.Delete(k); err != nil && err != buntdb.ErrNotFound {
 				return err
 			}
 		}
-		return err
+		return nil
 	})
 
-	return err
+	return wrapError(err)
 }
 
-// GetInt is a convenience method which retrieves a value from the cache, converts it to an int, and returns it.
-func (b *BuntDBCache) GetInt(key string) (int, error) {
-	val, err := b.Get(key)
+// GetMany retrieves several values from BuntDB in a single transaction. Keys which are not in the
+// cache are omitted from the returned map.
+func (b *BuntDBCache) GetMany(keys []string) (map[string]any, error) {
+	result := make(map[string]any, len(keys))
+
+	err := b.Conn.View(func(tx *buntdb.Tx) error {
+		for _, key := range keys {
+			val, err := tx.Get(b.key(key))
+			if err == buntdb.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			decoded, err := DecodeValue([]byte(val))
+			if err != nil {
+				return fmt.Errorf("key %s: %w", key, err)
+			}
+			result[key] = decoded
+		}
+		return nil
+	})
 	if err != nil {
-		return 0, err
+		return nil, wrapError(err)
 	}
 
-	return val.(int), nil
+	return result, nil
 }
 
-// GetString is a convenience method which retrieves a value from the cache and returns it as a string.
-func (b *BuntDBCache) GetString(key string) (string, error) {
-	s, err := b.Get(key)
+// SetMany puts several values into BuntDB in a single transaction. The final parameter, expires, is
+// optional, and applies to every item.
+func (b *BuntDBCache) SetMany(items map[string]any, expires ...time.Duration) error {
+	encoded := make(map[string]string, len(items))
+	for key, value := range items {
+		data, err := EncodeValue(b.Codec, value)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", key, err)
+		}
+		encoded[key] = string(data)
+	}
+
+	var so *buntdb.SetOptions
+	if len(expires) > 0 {
+		so = &buntdb.SetOptions{Expires: true, TTL: expires[0]}
+	}
+
+	err := b.Conn.Update(func(tx *buntdb.Tx) error {
+		for key, val := range encoded {
+			if _, _, err := tx.Set(b.key(key), val, so); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return wrapError(err)
+}
+
+// ForgetMany removes several items from the cache in a single transaction.
+func (b *BuntDBCache) ForgetMany(keys []string) error {
+	err := b.Conn.Update(func(tx *buntdb.Tx) error {
+		for _, key := range keys {
+			if _, err := tx.Delete(b.key(key)); err != nil && err != buntdb.ErrNotFound {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return wrapError(err)
+}
+
+// Increment atomically adds delta to the counter stored at key, and returns the new value. A missing
+// key is treated as 0. The optional ttl is applied only when the counter is created; an existing
+// counter keeps its expiry.
+func (b *BuntDBCache) Increment(key string, delta int64, ttl ...time.Duration) (int64, error) {
+	var n int64
+
+	err := b.Conn.Update(func(tx *buntdb.Tx) error {
+		var so *buntdb.SetOptions
+
+		val, err := tx.Get(b.key(key))
+		switch {
+		case err == buntdb.ErrNotFound:
+			n = 0
+			if expiration := CounterTTL(ttl); expiration > 0 {
+				so = &buntdb.SetOptions{Expires: true, TTL: expiration}
+			}
+
+		case err != nil:
+			return err
+
+		default:
+			if n, err = ParseCounter(key, []byte(val)); err != nil {
+				return err
+			}
+
+			remaining, err := tx.TTL(b.key(key))
+			if err != nil {
+				return err
+			}
+			if remaining >= 0 {
+				so = &buntdb.SetOptions{Expires: true, TTL: remaining}
+			}
+		}
+
+		n += delta
+		_, _, err = tx.Set(b.key(key), string(FormatCounter(n)), so)
+		return err
+	})
 	if err != nil {
-		return "", err
+		return 0, wrapError(err)
 	}
-	return s.(string), nil
+
+	return n, nil
 }
 
-// GetTime retrieves a value from the cache by the specified key and returns it as time.Time.
-func (b *BuntDBCache) GetTime(key string) (time.Time, error) {
-	fromCache, err := b.Get(key)
+// Decrement atomically subtracts delta from the counter stored at key, and returns the new value. See
+// Increment.
+func (b *BuntDBCache) Decrement(key string, delta int64, ttl ...time.Duration) (int64, error) {
+	return b.Increment(key, -delta, ttl...)
+}
+
+// TTL returns the time remaining before key expires, or NoExpiration if it never expires.
+func (b *BuntDBCache) TTL(key string) (time.Duration, error) {
+	var ttl time.Duration
+
+	err := b.Conn.View(func(tx *buntdb.Tx) error {
+		var err error
+		ttl, err = tx.TTL(b.key(key))
+		return err
+	})
 	if err != nil {
-		return time.Time{}, err
+		return 0, wrapError(err)
 	}
 
-	t := fromCache.(time.Time)
-	return t, nil
+	if ttl < 0 {
+		return NoExpiration, nil
+	}
+	return ttl, nil
+}
+
+// Touch sets the time remaining before key expires to ttl. The value is rewritten with the new expiry.
+func (b *BuntDBCache) Touch(key string, ttl time.Duration) error {
+	return b.setExpiry(key, &buntdb.SetOptions{Expires: true, TTL: ttl})
+}
+
+// Persist removes the expiry from key, so that it never expires.
+func (b *BuntDBCache) Persist(key string) error {
+	return b.setExpiry(key, nil)
+}
+
+// setExpiry rewrites the value stored at key with the expiry described by so.
+func (b *BuntDBCache) setExpiry(key string, so *buntdb.SetOptions) error {
+	err := b.Conn.Update(func(tx *buntdb.Tx) error {
+		val, err := tx.Get(b.key(key))
+		if err != nil {
+			return err
+		}
+
+		_, _, err = tx.Set(b.key(key), val, so)
+		return err
+	})
+
+	return wrapError(err)
+}
+
+// MigrateUnprefixed moves keys which were written without a prefix, and which begin with match, into
+// this client's prefix, preserving their expiry. Keys already carrying this client's prefix are left
+// alone, as are locks. Because keys written by other clients cannot be told apart from unprefixed
+// ones, only pass an empty match when this client is the sole user of the database. It returns the
+// number of keys moved.
+func (b *BuntDBCache) MigrateUnprefixed(match string) (int, error) {
+	if b.Prefix == "" {
+		return 0, errors.New("migrating keys requires a prefix")
+	}
+
+	own := b.Prefix + ":"
+	moved := 0
+
+	err := b.Conn.Update(func(tx *buntdb.Tx) error {
+		var keys []string
+		err := tx.AscendGreaterOrEqual("", match, func(key, value string) bool {
+			if !strings.HasPrefix(key, match) {
+				return false
+			}
+			if !strings.HasPrefix(key, own) && !strings.Contains(key, lockSpace) {
+				keys = append(keys, key)
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			ttl, err := tx.TTL(key)
+			if err == buntdb.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			val, err := tx.Delete(key)
+			if err != nil {
+				return err
+			}
+
+			var so *buntdb.SetOptions
+			if ttl >= 0 {
+				so = &buntdb.SetOptions{Expires: true, TTL: ttl}
+			}
+			if _, _, err := tx.Set(b.key(key), val, so); err != nil {
+				return err
+			}
+			moved++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, wrapError(err)
+	}
+
+	return moved, nil
+}
+
+// key returns the key as stored in BuntDB, including this client's prefix.
+func (b *BuntDBCache) key(str string) string {
+	if b.Prefix == "" {
+		return str
+	}
+	return b.Prefix + ":" + str
+}
+
+// GetInt is a convenience method which retrieves a value from the cache, converts it to an int, and returns it.
+func (b *BuntDBCache) GetInt(key string) (int, error) {
+	return GetInt(b, key)
+}
+
+// GetString is a convenience method which retrieves a value from the cache and returns it as a string.
+func (b *BuntDBCache) GetString(key string) (string, error) {
+	return GetAs[string](b, key)
+}
+
+// GetTime retrieves a value from the cache by the specified key and returns it as time.Time.
+func (b *BuntDBCache) GetTime(key string) (time.Time, error) {
+	return GetAs[time.Time](b, key)
 }
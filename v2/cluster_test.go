@@ -0,0 +1,87 @@
+package remember
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestNew_RedisClients(t *testing.T) {
+	tests := []struct {
+		name    string
+		ops     Options
+		cluster bool
+	}{
+		{"server and port", Options{Server: "localhost", Port: "6379"}, false},
+		{"single address", Options{Addrs: []string{"localhost:6379"}}, false},
+		{"sentinel", Options{Addrs: []string{"localhost:26379", "localhost:26380"}, MasterName: "mymaster"}, false},
+		{"several addresses", Options{Addrs: []string{"localhost:7000", "localhost:7001"}}, true},
+		{"cluster seed", Options{Addrs: []string{"localhost:7000"}, Cluster: true}, true},
+	}
+
+	for _, tt := range tests {
+		cache, err := New("redis", &tt.ops)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		_, isCluster := cache.(*RedisCache).Conn.(*redis.ClusterClient)
+		if isCluster != tt.cluster {
+			t.Errorf("%s: expected cluster client %t, got %t", tt.name, tt.cluster, isCluster)
+		}
+		_ = cache.Close()
+	}
+}
+
+func TestRedisCache_Cluster(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	cache, err := New("redis", &Options{Addrs: []string{s.Addr()}, Cluster: true, Prefix: "cluster", ScanBatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	unlinks := &heldUnlinks{s: s}
+	cache.(*RedisCache).Conn.(*redis.ClusterClient).OnNewNode(func(node *redis.Client) {
+		node.AddHook(unlinks)
+	})
+
+	err = cache.SetMany(map[string]any{"user:1": "a", "user:2": "b", "user:3": "c", "other": "d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := cache.GetMany([]string{"user:1", "user:3", "missing"})
+	if err != nil {
+		t.Error(err)
+	}
+	if len(values) != 2 || values["user:1"] != "a" || values["user:3"] != "c" {
+		t.Error("unexpected values from GetMany in cluster mode:", values)
+	}
+
+	deleted := 0
+	cache.(*RedisCache).OnProgress = func(n int) { deleted = n }
+
+	err = cache.EmptyByMatch("user:")
+	if err != nil {
+		t.Error(err)
+	}
+	unlinks.flush()
+	if deleted != 3 {
+		t.Error("expected 3 keys deleted, got", deleted)
+	}
+	if cache.Has("user:2") || !cache.Has("other") {
+		t.Error("EmptyByMatch removed the wrong keys in cluster mode")
+	}
+
+	err = cache.ForgetMany([]string{"other"})
+	if err != nil {
+		t.Error(err)
+	}
+	if cache.Has("other") {
+		t.Error("ForgetMany did not remove key in cluster mode")
+	}
+}
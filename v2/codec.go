@@ -0,0 +1,190 @@
+package remember
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec serializes values for storage in the cache. Every stored value is prefixed with a two byte
+// header, a zero byte followed by the codec's ID, so that a value can always be decoded regardless of
+// which codec the reading client is configured with. Other formats, such as protocol buffers, can be
+// supported by implementing Codec and calling RegisterCodec.
+type Codec interface {
+	// ID identifies the codec in the header of each stored value. IDs below 16 are reserved for the
+	// codecs provided by this package.
+	ID() byte
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte) (any, error)
+}
+
+// IDs of the built-in codecs.
+const (
+	GobCodecID     byte = 1
+	JSONCodecID    byte = 2
+	MsgpackCodecID byte = 3
+	RawCodecID     byte = 4
+)
+
+// firstCustomCodecID is the lowest ID a codec registered with RegisterCodec may use.
+const firstCustomCodecID byte = 16
+
+// codecMarker is the first byte of every value written with a header. It can never begin a legacy,
+// headerless gob value, since gob streams start with a non-zero message length.
+const codecMarker byte = 0
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[byte]Codec{
+		GobCodecID:     GobCodec{},
+		JSONCodecID:    JSONCodec{},
+		MsgpackCodecID: MsgpackCodec{},
+		RawCodecID:     RawCodec{},
+	}
+)
+
+// RegisterCodec makes a custom codec available for decoding. It must be called, typically from an init
+// function, by every program which reads values written with that codec. IDs below 16 are reserved,
+// and registering one is an error wrapping ErrInvalidOptions.
+func RegisterCodec(c Codec) error {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	if existing, ok := codecs[c.ID()]; ok {
+		return fmt.Errorf("codec id %d is already registered to %T", c.ID(), existing)
+	}
+	if c.ID() < firstCustomCodecID {
+		return fmt.Errorf("%w: codec id %d is reserved", ErrInvalidOptions, c.ID())
+	}
+	codecs[c.ID()] = c
+	return nil
+}
+
+// unregisterCodec removes the codec with the given ID, so that tests can clean up after themselves.
+func unregisterCodec(id byte) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	delete(codecs, id)
+}
+
+// lookupCodec returns the registered codec with the given ID.
+func lookupCodec(id byte) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	c, ok := codecs[id]
+	return c, ok
+}
+
+// GobCodec encodes values with encoding/gob. It is the default. As before, non-scalar types must be
+// registered with gob.Register.
+type GobCodec struct{}
+
+// gobEnvelope lets gob carry a value of any registered type.
+type gobEnvelope struct {
+	Value any
+}
+
+// ID satisfies the Codec interface.
+func (GobCodec) ID() byte {
+	return GobCodecID
+}
+
+// Marshal satisfies the Codec interface.
+func (GobCodec) Marshal(v any) ([]byte, error) {
+	b := bytes.Buffer{}
+	err := gob.NewEncoder(&b).Encode(gobEnvelope{Value: v})
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Unmarshal satisfies the Codec interface.
+func (GobCodec) Unmarshal(data []byte) (any, error) {
+	var env gobEnvelope
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&env)
+	if err != nil {
+		return nil, err
+	}
+	return env.Value, nil
+}
+
+// JSONCodec encodes values with encoding/json, so they can be read by services written in other
+// languages. Values are decoded into the types encoding/json uses for an any: objects become
+// map[string]any and numbers become float64.
+type JSONCodec struct{}
+
+// ID satisfies the Codec interface.
+func (JSONCodec) ID() byte {
+	return JSONCodecID
+}
+
+// Marshal satisfies the Codec interface.
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal satisfies the Codec interface.
+func (JSONCodec) Unmarshal(data []byte) (any, error) {
+	var v any
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// MsgpackCodec encodes values with MessagePack. Like JSONCodec, it is readable from other languages,
+// and decodes maps into map[string]any.
+type MsgpackCodec struct{}
+
+// ID satisfies the Codec interface.
+func (MsgpackCodec) ID() byte {
+	return MsgpackCodecID
+}
+
+// Marshal satisfies the Codec interface.
+func (MsgpackCodec) Marshal(v any) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+// Unmarshal satisfies the Codec interface.
+func (MsgpackCodec) Unmarshal(data []byte) (any, error) {
+	var v any
+	err := msgpack.Unmarshal(data, &v)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// RawCodec stores []byte and string values as they are, and returns them as []byte.
+type RawCodec struct{}
+
+// ID satisfies the Codec interface.
+func (RawCodec) ID() byte {
+	return RawCodecID
+}
+
+// Marshal satisfies the Codec interface.
+func (RawCodec) Marshal(v any) ([]byte, error) {
+	switch val := v.(type) {
+	case []byte:
+		return val, nil
+	case string:
+		return []byte(val), nil
+	default:
+		return nil, fmt.Errorf("raw codec can only store []byte or string values, not %T", v)
+	}
+}
+
+// Unmarshal satisfies the Codec interface.
+func (RawCodec) Unmarshal(data []byte) (any, error) {
+	return append([]byte{}, data...), nil
+}
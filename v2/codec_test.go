@@ -0,0 +1,146 @@
+package remember
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCodecs(t *testing.T) {
+	var tests = []struct {
+		name          string
+		codec         Codec
+		data          any
+		expected      any
+		errorExpected bool
+	}{
+		{name: "default", codec: nil, data: "bar", expected: "bar"},
+		{name: "gob", codec: GobCodec{}, data: 10, expected: 10},
+		{name: "json", codec: JSONCodec{}, data: map[string]any{"a": 1}, expected: map[string]any{"a": float64(1)}},
+		{name: "msgpack", codec: MsgpackCodec{}, data: []any{"a", "b"}, expected: []any{"a", "b"}},
+		{name: "raw bytes", codec: RawCodec{}, data: []byte("abc"), expected: []byte("abc")},
+		{name: "raw string", codec: RawCodec{}, data: "abc", expected: []byte("abc")},
+		{name: "raw int", codec: RawCodec{}, data: 1, errorExpected: true},
+	}
+
+	for _, tt := range tests {
+		c, _ := New("buntdb", &Options{BuntDBPath: ":memory:", Codec: tt.codec})
+
+		err := c.Set("codec", tt.data)
+		if err != nil && !tt.errorExpected {
+			t.Errorf("%s: received unexpected error: %s", tt.name, err.Error())
+		}
+		if err == nil && tt.errorExpected {
+			t.Errorf("%s: expected error but did not get one", tt.name)
+		}
+
+		if !tt.errorExpected {
+			x, err := c.Get("codec")
+			if err != nil {
+				t.Errorf("%s: received unexpected error: %s", tt.name, err.Error())
+			}
+			if !reflect.DeepEqual(x, tt.expected) {
+				t.Errorf("%s: wrong value retrieved; expected %#v but got %#v", tt.name, tt.expected, x)
+			}
+		}
+
+		_ = c.Close()
+	}
+}
+
+func TestCodecHeader(t *testing.T) {
+	c, _ := New("redis", &Options{
+		Server: testRedis.Host(),
+		Port:   testRedis.Port(),
+		Prefix: "test_codec",
+		Codec:  JSONCodec{},
+	})
+	defer c.Close()
+
+	err := c.Set("json", map[string]string{"name": "Mary"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	stored, _ := testRedis.Get("test_codec:json")
+	if stored != "\x00\x02"+`{"name":"Mary"}` {
+		t.Errorf("unexpected stored value %q", stored)
+	}
+
+	// A client using the default codec can still read the value.
+	gobClient := &RedisCache{Conn: c.(*RedisCache).Conn, Prefix: "test_codec"}
+	x, err := gobClient.Get("json")
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(x, map[string]any{"name": "Mary"}) {
+		t.Errorf("wrong value retrieved: %#v", x)
+	}
+
+	_ = c.Empty()
+}
+
+func TestDecodeLegacy(t *testing.T) {
+	b := bytes.Buffer{}
+	err := gob.NewEncoder(&b).Encode(CacheEntry{"foo": "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x, err := DecodeValue(b.Bytes())
+	if err != nil {
+		t.Error(err)
+	}
+	if x != "bar" {
+		t.Error("wrong value decoded from legacy entry:", x)
+	}
+
+	_, err = DecodeValue([]byte{codecMarker, 200, 'x'})
+	if !errors.Is(err, ErrDecode) {
+		t.Error("expected ErrDecode for an unknown codec, got", err)
+	}
+}
+
+type upperCodec struct{ RawCodec }
+
+func (upperCodec) ID() byte {
+	return 100
+}
+
+type reservedCodec struct{ RawCodec }
+
+func (reservedCodec) ID() byte {
+	return 9
+}
+
+func TestRegisterCodec(t *testing.T) {
+	err := RegisterCodec(upperCodec{})
+	if err != nil {
+		t.Error(err)
+	}
+	t.Cleanup(func() { unregisterCodec(upperCodec{}.ID()) })
+
+	err = RegisterCodec(upperCodec{})
+	if err == nil {
+		t.Error("expected error registering a duplicate codec id")
+	}
+
+	data, _ := EncodeValue(upperCodec{}, "x")
+	x, err := DecodeValue(data)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(x, []byte("x")) {
+		t.Error("wrong value decoded with custom codec:", x)
+	}
+
+	err = RegisterCodec(reservedCodec{})
+	if !errors.Is(err, ErrInvalidOptions) {
+		t.Error("expected ErrInvalidOptions registering a reserved codec id, got", err)
+	}
+	if _, ok := lookupCodec(reservedCodec{}.ID()); ok {
+		t.Error("a codec with a reserved id was registered")
+	}
+}
@@ -0,0 +1,48 @@
+package remember
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ParseCounter parses a stored counter. Counters written by Increment and Decrement are stored as
+// plain base 10 integers, with no codec header, so that Redis's INCRBY can operate on them and other
+// languages can read them. Get returns a counter as an int64, and GetInt converts it to an int.
+// Calling Increment on a key which holds an encoded value, rather than a counter, returns
+// ErrNotInteger and leaves the value untouched; likewise, overwriting a counter with Set turns it back
+// into an ordinary encoded value.
+func ParseCounter(key string, data []byte) (int64, error) {
+	n, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: key %s", ErrNotInteger, key)
+	}
+	return n, nil
+}
+
+// FormatCounter formats a counter for storage.
+func FormatCounter(n int64) []byte {
+	return strconv.AppendInt(nil, n, 10)
+}
+
+// CounterTTL returns the TTL which should be applied to a counter when it is first created.
+func CounterTTL(ttl []time.Duration) time.Duration {
+	if len(ttl) > 0 && ttl[0] > 0 {
+		return ttl[0]
+	}
+	return 0
+}
+
+// GetInt implements CacheInterface.GetInt for c, accepting the int64 values of counters as well as
+// ints. It is exported, like the other helpers in this file, for packages which provide a backend.
+func GetInt(c CacheInterface, key string) (int, error) {
+	val, err := c.Get(key)
+	if err != nil {
+		return 0, err
+	}
+
+	if n, ok := val.(int64); ok {
+		return int(n), nil
+	}
+	return as[int](key, val)
+}
@@ -0,0 +1,54 @@
+package remember
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/redis/go-redis/v9"
+	"github.com/tidwall/buntdb"
+)
+
+// Errors returned by every backend, so callers can use errors.Is without knowing which cacheType was
+// passed to New. The original backend error is wrapped as well, so checks such as
+// errors.Is(err, redis.Nil) continue to work.
+var (
+	// ErrNotFound is returned when a key is not in the cache.
+	ErrNotFound = errors.New("key not found in cache")
+
+	// ErrExpired is returned when a key exists but has expired, by backends which detect expiry
+	// themselves. Redis, Badger and BuntDB drop expired keys internally, so there an expired key is
+	// reported as ErrNotFound. ErrExpired wraps ErrNotFound, so checking errors.Is(err, ErrNotFound)
+	// covers expired keys on every backend.
+	ErrExpired = fmt.Errorf("%w: entry has expired", ErrNotFound)
+
+	// ErrDecode is returned when a value was found in the cache but could not be deserialized.
+	ErrDecode = errors.New("unable to decode cached value")
+
+	// ErrNotInteger is returned by Increment and Decrement when the key holds something other than a
+	// counter.
+	ErrNotInteger = errors.New("cached value is not an integer counter")
+
+	// ErrClosed is returned when an operation is attempted on a cache which has been closed.
+	ErrClosed = errors.New("cache is closed")
+)
+
+// wrapError maps backend-specific errors onto the package's sentinel errors. Errors which are
+// already sentinels, and errors with no equivalent, are returned unchanged.
+func wrapError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrClosed), errors.Is(err, ErrDecode):
+		return err
+
+	case errors.Is(err, redis.Nil), errors.Is(err, badger.ErrKeyNotFound), errors.Is(err, buntdb.ErrNotFound):
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+
+	case errors.Is(err, redis.ErrClosed), errors.Is(err, badger.ErrDBClosed), errors.Is(err, buntdb.ErrDatabaseClosed):
+		return fmt.Errorf("%w: %w", ErrClosed, err)
+
+	default:
+		return err
+	}
+}
@@ -0,0 +1,67 @@
+package remember
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tidwall/buntdb"
+)
+
+func TestErrors(t *testing.T) {
+	redisCache, _ := New("redis", &Options{
+		Server: testRedis.Host(),
+		Port:   testRedis.Port(),
+		Prefix: "test_errors",
+	})
+	badgerCache, err := New("badger", &Options{BadgerPath: "./testdata/badger_errors"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buntCache, _ := New("buntdb")
+
+	caches := map[string]CacheInterface{
+		"redis":  redisCache,
+		"badger": badgerCache,
+		"buntdb": buntCache,
+	}
+
+	for name, c := range caches {
+		_, err := c.Get("missing")
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: expected ErrNotFound for missing key, got %v", name, err)
+		}
+
+		_, err = GetAs[int](c, "missing")
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: expected ErrNotFound from GetAs, got %v", name, err)
+		}
+
+		if err := c.Forget("missing"); err != nil {
+			t.Errorf("%s: forgetting a missing key should not be an error, got %v", name, err)
+		}
+	}
+
+	testRedis.Set("test_errors:junk", "not gob")
+	_ = buntCache.(*BuntDBCache).Conn.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set("junk", "not gob", nil)
+		return err
+	})
+	for _, name := range []string{"redis", "buntdb"} {
+		_, err := caches[name].Get("junk")
+		if !errors.Is(err, ErrDecode) {
+			t.Errorf("%s: expected ErrDecode, got %v", name, err)
+		}
+	}
+
+	for name, c := range caches {
+		_ = c.Close()
+		_, err := c.Get("anything")
+		if !errors.Is(err, ErrClosed) {
+			t.Errorf("%s: expected ErrClosed after Close, got %v", name, err)
+		}
+	}
+
+	if !errors.Is(ErrExpired, ErrNotFound) {
+		t.Error("ErrExpired should match ErrNotFound")
+	}
+}
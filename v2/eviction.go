@@ -0,0 +1,256 @@
+package remember
+
+import (
+	"container/heap"
+	"container/list"
+	"fmt"
+)
+
+// Eviction policies supported by the memory cache.
+const (
+	EvictLRU = "lru" // Evict the least recently used entry.
+	EvictLFU = "lfu" // Evict the least frequently used entry, breaking ties by age.
+	EvictARC = "arc" // Adaptive replacement, which balances recency and frequency as the workload changes.
+)
+
+// defaultARCCapacity bounds the ghost lists of an ARC shard when no MaxEntries is configured.
+const defaultARCCapacity = 10000
+
+// evictionPolicy tracks the keys resident in one memory cache shard and chooses which to evict. It is
+// not safe for concurrent use; the shard's lock protects it.
+type evictionPolicy interface {
+	added(key string)
+	accessed(key string)
+	removed(key string)
+	victim() (string, bool)
+}
+
+// newEvictionPolicy returns the policy with the given name. capacity is the shard's entry limit, or 0
+// if it has none.
+func newEvictionPolicy(name string, capacity int) (evictionPolicy, error) {
+	switch name {
+	case "", EvictLRU:
+		return newLRUPolicy(), nil
+	case EvictLFU:
+		return newLFUPolicy(), nil
+	case EvictARC:
+		if capacity <= 0 {
+			capacity = defaultARCCapacity
+		}
+		return newARCPolicy(capacity), nil
+	default:
+		return nil, fmt.Errorf("unsupported eviction policy %q", name)
+	}
+}
+
+// lruPolicy evicts the least recently used key.
+type lruPolicy struct {
+	order *list.List // Most recently used at the front.
+	keys  map[string]*list.Element
+}
+
+func newLRUPolicy() *lruPolicy {
+	return &lruPolicy{order: list.New(), keys: make(map[string]*list.Element)}
+}
+
+func (p *lruPolicy) added(key string) {
+	p.keys[key] = p.order.PushFront(key)
+}
+
+func (p *lruPolicy) accessed(key string) {
+	if e, ok := p.keys[key]; ok {
+		p.order.MoveToFront(e)
+	}
+}
+
+func (p *lruPolicy) removed(key string) {
+	if e, ok := p.keys[key]; ok {
+		p.order.Remove(e)
+		delete(p.keys, key)
+	}
+}
+
+func (p *lruPolicy) victim() (string, bool) {
+	e := p.order.Back()
+	if e == nil {
+		return "", false
+	}
+	key := e.Value.(string)
+	p.removed(key)
+	return key, true
+}
+
+// lfuPolicy evicts the least frequently used key, using a min-heap ordered by use count and then by
+// the time of last use.
+type lfuPolicy struct {
+	items lfuHeap
+	keys  map[string]*lfuItem
+	tick  uint64
+}
+
+type lfuItem struct {
+	key   string
+	count uint64
+	tick  uint64
+	index int
+}
+
+type lfuHeap []*lfuItem
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].count != h[j].count {
+		return h[i].count < h[j].count
+	}
+	return h[i].tick < h[j].tick
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x any) {
+	item := x.(*lfuItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *lfuHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return item
+}
+
+func newLFUPolicy() *lfuPolicy {
+	return &lfuPolicy{keys: make(map[string]*lfuItem)}
+}
+
+func (p *lfuPolicy) added(key string) {
+	p.tick++
+	item := &lfuItem{key: key, count: 1, tick: p.tick}
+	heap.Push(&p.items, item)
+	p.keys[key] = item
+}
+
+func (p *lfuPolicy) accessed(key string) {
+	if item, ok := p.keys[key]; ok {
+		p.tick++
+		item.count++
+		item.tick = p.tick
+		heap.Fix(&p.items, item.index)
+	}
+}
+
+func (p *lfuPolicy) removed(key string) {
+	if item, ok := p.keys[key]; ok {
+		heap.Remove(&p.items, item.index)
+		delete(p.keys, key)
+	}
+}
+
+func (p *lfuPolicy) victim() (string, bool) {
+	if len(p.items) == 0 {
+		return "", false
+	}
+	item := heap.Pop(&p.items).(*lfuItem)
+	delete(p.keys, item.key)
+	return item.key, true
+}
+
+// arcPolicy implements adaptive replacement. Resident keys seen once live in t1 and keys seen more than
+// once in t2; b1 and b2 remember recently evicted keys from each, and hits on those ghosts shift the
+// target size p of t1 towards whichever list would have kept the key.
+type arcPolicy struct {
+	capacity       int
+	p              int
+	t1, t2, b1, b2 *list.List // Most recently used at the front of each.
+	keys           map[string]*list.Element
+}
+
+// arcItem records which of the four lists a key is in.
+type arcItem struct {
+	key  string
+	list *list.List
+}
+
+func newARCPolicy(capacity int) *arcPolicy {
+	return &arcPolicy{
+		capacity: capacity,
+		t1:       list.New(),
+		t2:       list.New(),
+		b1:       list.New(),
+		b2:       list.New(),
+		keys:     make(map[string]*list.Element),
+	}
+}
+
+func (p *arcPolicy) push(l *list.List, key string) {
+	p.keys[key] = l.PushFront(&arcItem{key: key, list: l})
+}
+
+func (p *arcPolicy) unlink(key string) *list.List {
+	e, ok := p.keys[key]
+	if !ok {
+		return nil
+	}
+	item := e.Value.(*arcItem)
+	item.list.Remove(e)
+	delete(p.keys, key)
+	return item.list
+}
+
+func (p *arcPolicy) added(key string) {
+	switch p.unlink(key) {
+	case p.b1:
+		p.p = min(p.capacity, p.p+max(p.b2.Len()/max(p.b1.Len(), 1), 1))
+		p.push(p.t2, key)
+	case p.b2:
+		p.p = max(0, p.p-max(p.b1.Len()/max(p.b2.Len(), 1), 1))
+		p.push(p.t2, key)
+	default:
+		p.push(p.t1, key)
+	}
+
+	for _, ghosts := range []*list.List{p.b1, p.b2} {
+		for ghosts.Len() > p.capacity {
+			p.unlink(ghosts.Back().Value.(*arcItem).key)
+		}
+	}
+}
+
+func (p *arcPolicy) accessed(key string) {
+	e, ok := p.keys[key]
+	if !ok {
+		return
+	}
+	if l := e.Value.(*arcItem).list; l == p.t1 || l == p.t2 {
+		p.unlink(key)
+		p.push(p.t2, key)
+	}
+}
+
+func (p *arcPolicy) removed(key string) {
+	p.unlink(key)
+}
+
+func (p *arcPolicy) victim() (string, bool) {
+	from, ghosts := p.t2, p.b2
+	if p.t1.Len() > 0 && (p.t1.Len() > p.p || p.t2.Len() == 0) {
+		from, ghosts = p.t1, p.b1
+	}
+
+	e := from.Back()
+	if e == nil {
+		return "", false
+	}
+
+	key := e.Value.(*arcItem).key
+	p.unlink(key)
+	p.push(ghosts, key)
+	return key, true
+}
@@ -0,0 +1,563 @@
+package remember
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/sync/singleflight"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FileCache is the type for a cache kept as one file per key in a directory tree, which can be
+// inspected, copied and cleaned up with ordinary tools. Each prefix has its own directory below Root,
+// and files are spread over two levels of subdirectories named after the hash of the key. Every file
+// holds the key and its expiry in front of the encoded value, and is written to a temporary file which
+// is then renamed into place, so readers never see a partial write.
+//
+// Expired files are not removed when they are read; call Cleanup, for example from a scheduled job.
+// Increment is atomic between goroutines, but not between processes sharing the directory.
+type FileCache struct {
+	Root   string
+	Prefix string
+	Codec  Codec // The codec used to serialize values. Defaults to GobCodec.
+	group  singleflight.Group
+	locks  [64]sync.Mutex
+	closed atomic.Bool
+}
+
+// fileMagic starts every file written by FileCache.
+var fileMagic = []byte("RMB\x01")
+
+const (
+	// fileHeaderSize is the length of the magic, the expiry and the key length.
+	fileHeaderSize = 16
+
+	// fileTempPattern names temporary files, which Cleanup removes once they are abandoned.
+	fileTempPattern = ".tmp-*"
+
+	// fileTempMaxAge is how old a temporary file must be before Cleanup treats it as abandoned.
+	fileTempMaxAge = time.Hour
+)
+
+func init() {
+	_ = Register("file", func(ops *Options) (CacheInterface, error) {
+		cache, err := newFile(ops)
+		if err != nil {
+			return nil, err
+		}
+		return cache, nil
+	})
+}
+
+// newFile validates ops and returns a file cache rooted at ops.FilePath, creating the directory if
+// necessary.
+func newFile(ops *Options) (*FileCache, error) {
+	if err := ops.validate("file"); err != nil {
+		return nil, err
+	}
+
+	f := &FileCache{
+		Root:   ops.FilePath,
+		Prefix: ops.Prefix,
+		Codec:  ops.Codec,
+	}
+	if err := os.MkdirAll(f.dir(), 0755); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Close marks the cache as closed. There is nothing to release, but any later operation returns
+// ErrClosed.
+func (f *FileCache) Close() error {
+	if !f.closed.CompareAndSwap(false, true) {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Has checks to see if the supplied key is in the cache and returns true if found, otherwise false.
+func (f *FileCache) Has(key string) bool {
+	_, err := f.Get(key)
+	return err == nil
+}
+
+// Get attempts to retrieve a value from the cache.
+func (f *FileCache) Get(key string) (any, error) {
+	_, payload, err := f.read(key)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeValue(payload)
+}
+
+// Set puts a value into the cache. The final parameter, expires, is optional.
+func (f *FileCache) Set(key string, value any, expires ...time.Duration) error {
+	data, err := EncodeValue(f.Codec, value)
+	if err != nil {
+		return err
+	}
+
+	var expiresAt time.Time
+	if len(expires) > 0 && expires[0] > 0 {
+		expiresAt = time.Now().Add(expires[0])
+	}
+
+	mu := f.lock(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	return f.write(key, expiresAt, data)
+}
+
+// Remember returns the value stored at key. If the key is not in the cache, fn is called to compute
+// the value, which is stored with the given ttl (0 means no expiry) and returned. Concurrent misses
+// for the same key share a single call to fn.
+func (f *FileCache) Remember(key string, ttl time.Duration, fn func() (any, error)) (any, error) {
+	return Remember(f, &f.group, key, ttl, fn)
+}
+
+// Forget removes an item from the cache, by key.
+func (f *FileCache) Forget(key string) error {
+	if f.closed.Load() {
+		return ErrClosed
+	}
+
+	mu := f.lock(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	err := os.Remove(f.path(key))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// GetMany retrieves several values from the cache. Keys which are not in the cache are omitted from
+// the returned map.
+func (f *FileCache) GetMany(keys []string) (map[string]any, error) {
+	result := make(map[string]any, len(keys))
+	for _, key := range keys {
+		val, err := f.Get(key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result[key] = val
+	}
+	return result, nil
+}
+
+// SetMany puts several values into the cache. The final parameter, expires, is optional, and applies
+// to every item.
+func (f *FileCache) SetMany(items map[string]any, expires ...time.Duration) error {
+	for key, value := range items {
+		if err := f.Set(key, value, expires...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForgetMany removes several items from the cache.
+func (f *FileCache) ForgetMany(keys []string) error {
+	for _, key := range keys {
+		if err := f.Forget(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EmptyByMatch removes all entries in the cache which have the prefix match. File names are hashes, so
+// every file's header is read to find its key.
+func (f *FileCache) EmptyByMatch(match string) error {
+	if match == "" {
+		return f.Empty()
+	}
+
+	return f.walk(func(path string, key string, _ time.Time) error {
+		if !strings.HasPrefix(key, match) {
+			return nil
+		}
+
+		mu := f.lock(key)
+		mu.Lock()
+		defer mu.Unlock()
+
+		return os.Remove(path)
+	})
+}
+
+// Empty removes all entries in the cache, by removing the prefix's directory.
+func (f *FileCache) Empty() error {
+	if f.closed.Load() {
+		return ErrClosed
+	}
+
+	if err := os.RemoveAll(f.dir()); err != nil {
+		return err
+	}
+	return os.MkdirAll(f.dir(), 0755)
+}
+
+// GetCtx attempts to retrieve a value from the cache, returning ctx.Err() if ctx is already done.
+func (f *FileCache) GetCtx(ctx context.Context, key string) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return f.Get(key)
+}
+
+// HasCtx checks for existence of item in cache, returning false if ctx is already done.
+func (f *FileCache) HasCtx(ctx context.Context, key string) bool {
+	return ctx.Err() == nil && f.Has(key)
+}
+
+// SetCtx puts a value into the cache, returning ctx.Err() if ctx is already done. The final
+// parameter, expires, is optional.
+func (f *FileCache) SetCtx(ctx context.Context, key string, value any, expires ...time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return f.Set(key, value, expires...)
+}
+
+// ForgetCtx removes an item from the cache, by key, returning ctx.Err() if ctx is already done.
+func (f *FileCache) ForgetCtx(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return f.Forget(key)
+}
+
+// EmptyByMatchCtx removes all entries in the cache which have the prefix match, returning ctx.Err()
+// if ctx is already done.
+func (f *FileCache) EmptyByMatchCtx(ctx context.Context, match string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return f.EmptyByMatch(match)
+}
+
+// EmptyCtx removes all entries from the cache, returning ctx.Err() if ctx is already done.
+func (f *FileCache) EmptyCtx(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return f.Empty()
+}
+
+// Cleanup removes expired entries, and temporary files abandoned by interrupted writes, from the
+// prefix's directory.
+func (f *FileCache) Cleanup() error {
+	now := time.Now()
+
+	err := f.walk(func(path string, key string, expiresAt time.Time) error {
+		if expiresAt.IsZero() || now.Before(expiresAt) {
+			return nil
+		}
+
+		// The file may have been rewritten since it was read.
+		mu := f.lock(key)
+		mu.Lock()
+		defer mu.Unlock()
+
+		if _, _, err := f.read(key); !errors.Is(err, ErrExpired) {
+			return nil
+		}
+		return os.Remove(path)
+	})
+	if err != nil {
+		return err
+	}
+
+	temps, err := filepath.Glob(filepath.Join(f.dir(), "*", "*", fileTempPattern))
+	if err != nil {
+		return err
+	}
+	for _, temp := range temps {
+		info, err := os.Stat(temp)
+		if err == nil && now.Sub(info.ModTime()) > fileTempMaxAge {
+			_ = os.Remove(temp)
+		}
+	}
+	return nil
+}
+
+// Increment atomically adds delta to the int64 counter stored at key, and returns the new value. A
+// missing key is treated as 0. The optional ttl is applied only when the counter is created; an
+// existing counter keeps its expiry. Increments are only atomic within one process.
+func (f *FileCache) Increment(key string, delta int64, ttl ...time.Duration) (int64, error) {
+	mu := f.lock(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	expiresAt, payload, err := f.read(key)
+	var n int64
+	switch {
+	case err == nil:
+		if n, err = ParseCounter(key, payload); err != nil {
+			return 0, err
+		}
+
+	case errors.Is(err, ErrNotFound):
+		expiresAt = time.Time{}
+		if t := CounterTTL(ttl); t > 0 {
+			expiresAt = time.Now().Add(t)
+		}
+
+	default:
+		return 0, err
+	}
+
+	n += delta
+	if err := f.write(key, expiresAt, FormatCounter(n)); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Decrement atomically subtracts delta from the counter stored at key, and returns the new value. See
+// Increment.
+func (f *FileCache) Decrement(key string, delta int64, ttl ...time.Duration) (int64, error) {
+	return f.Increment(key, -delta, ttl...)
+}
+
+// TTL returns the time remaining before key expires, or NoExpiration if it never expires.
+func (f *FileCache) TTL(key string) (time.Duration, error) {
+	expiresAt, _, err := f.read(key)
+	if err != nil {
+		return 0, err
+	}
+	if expiresAt.IsZero() {
+		return NoExpiration, nil
+	}
+	return time.Until(expiresAt), nil
+}
+
+// Touch sets the time remaining before key expires to ttl.
+func (f *FileCache) Touch(key string, ttl time.Duration) error {
+	return f.setExpiry(key, time.Now().Add(ttl))
+}
+
+// Persist removes the expiry from key, so that it never expires.
+func (f *FileCache) Persist(key string) error {
+	return f.setExpiry(key, time.Time{})
+}
+
+// setExpiry rewrites the file for key with a new expiry. The zero time means it never expires.
+func (f *FileCache) setExpiry(key string, expiresAt time.Time) error {
+	mu := f.lock(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	_, payload, err := f.read(key)
+	if err != nil {
+		return err
+	}
+	return f.write(key, expiresAt, payload)
+}
+
+// GetInt is a convenience method which retrieves a value from the cache, converts it to an int, and returns it.
+func (f *FileCache) GetInt(key string) (int, error) {
+	return GetInt(f, key)
+}
+
+// GetString is a convenience method which retrieves a value from the cache and returns it as a string.
+func (f *FileCache) GetString(key string) (string, error) {
+	return GetAs[string](f, key)
+}
+
+// GetTime retrieves a value from the cache by the specified key and returns it as time.Time.
+func (f *FileCache) GetTime(key string) (time.Time, error) {
+	return GetAs[time.Time](f, key)
+}
+
+// read returns the expiry and payload of the live file for key.
+func (f *FileCache) read(key string) (time.Time, []byte, error) {
+	if f.closed.Load() {
+		return time.Time{}, nil, ErrClosed
+	}
+
+	data, err := os.ReadFile(f.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return time.Time{}, nil, ErrNotFound
+	}
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+
+	stored, expiresAt, payload, err := parseFile(data)
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	if stored != key {
+		return time.Time{}, nil, ErrNotFound
+	}
+	if !expiresAt.IsZero() && !time.Now().Before(expiresAt) {
+		return time.Time{}, nil, ErrExpired
+	}
+	return expiresAt, payload, nil
+}
+
+// write stores payload for key, by writing a temporary file in the same directory and renaming it over
+// the old one.
+func (f *FileCache) write(key string, expiresAt time.Time, payload []byte) error {
+	if f.closed.Load() {
+		return ErrClosed
+	}
+
+	path := f.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), fileTempPattern)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	header := make([]byte, fileHeaderSize, fileHeaderSize+len(key))
+	copy(header, fileMagic)
+	if !expiresAt.IsZero() {
+		binary.BigEndian.PutUint64(header[4:], uint64(expiresAt.UnixNano()))
+	}
+	binary.BigEndian.PutUint32(header[12:], uint32(len(key)))
+	header = append(header, key...)
+
+	_, err = tmp.Write(header)
+	if err == nil {
+		_, err = tmp.Write(payload)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// walk calls fn with the path, key and expiry of every file in the prefix's directory. Only each file's
+// header is read.
+func (f *FileCache) walk(fn func(path string, key string, expiresAt time.Time) error) error {
+	if f.closed.Load() {
+		return ErrClosed
+	}
+
+	return filepath.WalkDir(f.dir(), func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+
+		key, expiresAt, err := readFileHeader(path)
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, ErrDecode) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = fn(path, key, expiresAt)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	})
+}
+
+// readFileHeader reads just the key and expiry from the file at path.
+func readFileHeader(path string) (string, time.Time, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer file.Close()
+
+	header := make([]byte, fileHeaderSize)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return "", time.Time{}, fmt.Errorf("%w: %w", ErrDecode, err)
+	}
+	key := make([]byte, binary.BigEndian.Uint32(header[12:]))
+	if _, err := io.ReadFull(file, key); err != nil {
+		return "", time.Time{}, fmt.Errorf("%w: %w", ErrDecode, err)
+	}
+
+	stored, expiresAt, _, err := parseFile(append(header, key...))
+	return stored, expiresAt, err
+}
+
+// parseFile separates the contents of a cache file into its key, expiry and payload.
+func parseFile(data []byte) (string, time.Time, []byte, error) {
+	if len(data) < fileHeaderSize || !bytes.Equal(data[:4], fileMagic) {
+		return "", time.Time{}, nil, fmt.Errorf("%w: not a cache file", ErrDecode)
+	}
+
+	var expiresAt time.Time
+	if nanos := binary.BigEndian.Uint64(data[4:]); nanos != 0 {
+		expiresAt = time.Unix(0, int64(nanos))
+	}
+
+	end := fileHeaderSize + int(binary.BigEndian.Uint32(data[12:]))
+	if end > len(data) {
+		return "", time.Time{}, nil, fmt.Errorf("%w: truncated cache file", ErrDecode)
+	}
+	return string(data[fileHeaderSize:end]), expiresAt, data[end:], nil
+}
+
+// path returns the file holding key: the hex SHA-256 of the key, two levels of directories deep.
+func (f *FileCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(f.dir(), name[:2], name[2:4], name)
+}
+
+// dir returns the directory holding this client's files. An empty prefix uses "_"; otherwise every
+// byte of the prefix other than a letter, digit or hyphen is escaped as %XX, so that any prefix is a
+// safe and distinct directory name.
+func (f *FileCache) dir() string {
+	if f.Prefix == "" {
+		return filepath.Join(f.Root, "_")
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(f.Prefix); i++ {
+		c := f.Prefix[i]
+		if c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return filepath.Join(f.Root, b.String())
+}
+
+// lock returns the mutex guarding changes to the file for key, so that a write or removal cannot be
+// lost in the middle of a read-modify-write such as Increment.
+func (f *FileCache) lock(key string) *sync.Mutex {
+	sum := sha256.Sum256([]byte(key))
+	return &f.locks[int(sum[0])%len(f.locks)]
+}
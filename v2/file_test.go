@@ -0,0 +1,122 @@
+package remember
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestFileCache returns a FileCache rooted in a temporary directory.
+func newTestFileCache(t *testing.T, prefix string) *FileCache {
+	t.Helper()
+
+	cache, err := NewFile(WithFilePath(t.TempDir()), WithPrefix(prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = cache.Close() })
+	return cache
+}
+
+// countFiles returns the number of regular files below dir.
+func countFiles(t *testing.T, dir string) int {
+	t.Helper()
+
+	n := 0
+	err := filepath.WalkDir(dir, func(_ string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			n++
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestFileCache_Files(t *testing.T) {
+	cache := newTestFileCache(t, "test")
+
+	_ = cache.Set("foo", "bar")
+	_ = cache.Set("../../etc/passwd", "safe")
+	_ = cache.Set("foo", "baz")
+	if n := countFiles(t, cache.Root); n != 2 {
+		t.Error("expected one file per key, got", n)
+	}
+
+	_ = cache.Forget("foo")
+	if n := countFiles(t, cache.Root); n != 1 {
+		t.Error("expected Forget to remove the file, got", n)
+	}
+}
+
+func TestFileCache_Layout(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		expected string
+	}{
+		{"", "_"},
+		{"myapp", "myapp"},
+		{"my_app", "my%5Fapp"},
+		{"..", "%2E%2E"},
+		{"a/b", "a%2Fb"},
+	}
+
+	for _, tt := range tests {
+		f := &FileCache{Root: "root", Prefix: tt.prefix}
+		if dir := f.dir(); dir != filepath.Join("root", tt.expected) {
+			t.Errorf("prefix %q: expected directory %q, got %q", tt.prefix, tt.expected, dir)
+		}
+	}
+
+	f := &FileCache{Root: "root", Prefix: "myapp"}
+	path := f.path("foo")
+	name := filepath.Base(path)
+	if filepath.Dir(path) != filepath.Join("root", "myapp", name[:2], name[2:4]) || len(name) != 64 {
+		t.Error("unexpected path for key:", path)
+	}
+}
+
+func TestFileCache_Cleanup(t *testing.T) {
+	cache := newTestFileCache(t, "test")
+
+	_ = cache.Set("short", "value", 10*time.Millisecond)
+	_ = cache.Set("kept", "value")
+	time.Sleep(15 * time.Millisecond)
+
+	abandoned := filepath.Join(filepath.Dir(cache.path("kept")), ".tmp-abandoned")
+	_ = os.WriteFile(abandoned, []byte("partial"), 0644)
+	old := time.Now().Add(-2 * fileTempMaxAge)
+	_ = os.Chtimes(abandoned, old, old)
+
+	err := cache.Cleanup()
+	if err != nil {
+		t.Error(err)
+	}
+	if n := countFiles(t, cache.Root); n != 1 {
+		t.Error("expected Cleanup to leave 1 file, got", n)
+	}
+	if !cache.Has("kept") {
+		t.Error("Cleanup removed a live entry")
+	}
+}
+
+func TestFileCache_Corrupt(t *testing.T) {
+	cache := newTestFileCache(t, "test")
+
+	_ = cache.Set("foo", "bar")
+	_ = os.WriteFile(cache.path("foo"), []byte("garbage"), 0644)
+
+	_, err := cache.Get("foo")
+	if !errors.Is(err, ErrDecode) {
+		t.Error("expected ErrDecode for a corrupt file, got", err)
+	}
+
+	err = cache.EmptyByMatch("f")
+	if err != nil {
+		t.Error("expected EmptyByMatch to skip corrupt files, got", err)
+	}
+}
@@ -0,0 +1,74 @@
+package remember
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// ErrTypeMismatch is returned, wrapped in a *TypeMismatchError, when a value in the cache is not of the
+// type the caller asked for.
+var ErrTypeMismatch = errors.New("cached value has unexpected type")
+
+// TypeMismatchError describes a value which was found in the cache, but was not of the requested type.
+type TypeMismatchError struct {
+	Key      string // The key that was looked up.
+	Expected string // The type the caller asked for.
+	Actual   string // The type actually stored in the cache.
+}
+
+// Error satisfies the error interface.
+func (e *TypeMismatchError) Error() string {
+	return fmt.Sprintf("%s: value for key %s is %s, not %s", ErrTypeMismatch, e.Key, e.Actual, e.Expected)
+}
+
+// Unwrap allows errors.Is(err, ErrTypeMismatch) to match a *TypeMismatchError.
+func (e *TypeMismatchError) Unwrap() error {
+	return ErrTypeMismatch
+}
+
+// GetAs retrieves a value from the cache and returns it as type T. If the stored value is not a T,
+// a *TypeMismatchError is returned rather than panicking.
+func GetAs[T any](c CacheInterface, key string) (T, error) {
+	val, err := c.Get(key)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return as[T](key, val)
+}
+
+// SetAs puts a value of type T into the cache. The final parameter, expires, is optional.
+func SetAs[T any](c CacheInterface, key string, value T, expires ...time.Duration) error {
+	return c.Set(key, value, expires...)
+}
+
+// RememberAs is the typed equivalent of CacheInterface.Remember: it returns the value stored at key as
+// type T, or calls fn, stores the result for ttl, and returns it.
+func RememberAs[T any](c CacheInterface, key string, ttl time.Duration, fn func() (T, error)) (T, error) {
+	val, err := c.Remember(key, ttl, func() (any, error) {
+		return fn()
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return as[T](key, val)
+}
+
+// as performs a checked type assertion of val to T.
+func as[T any](key string, val any) (T, error) {
+	t, ok := val.(T)
+	if !ok {
+		return t, &TypeMismatchError{
+			Key:      key,
+			Expected: reflect.TypeOf((*T)(nil)).Elem().String(),
+			Actual:   fmt.Sprintf("%T", val),
+		}
+	}
+
+	return t, nil
+}
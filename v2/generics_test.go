@@ -0,0 +1,99 @@
+package remember
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGetAs(t *testing.T) {
+	c, err := New("buntdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	err = SetAs(c, "count", 42)
+	if err != nil {
+		t.Error(err)
+	}
+
+	var tests = []struct {
+		name          string
+		get           func() (any, error)
+		expected      any
+		errorExpected error
+	}{
+		{
+			name:     "valid",
+			get:      func() (any, error) { return GetAs[int](c, "count") },
+			expected: 42,
+		},
+		{
+			name:          "wrong type",
+			get:           func() (any, error) { return GetAs[string](c, "count") },
+			expected:      "",
+			errorExpected: ErrTypeMismatch,
+		},
+		{
+			name:          "helper with wrong type",
+			get:           func() (any, error) { return c.GetTime("count") },
+			expected:      time.Time{},
+			errorExpected: ErrTypeMismatch,
+		},
+		{
+			name:     "interface type",
+			get:      func() (any, error) { return GetAs[any](c, "count") },
+			expected: 42,
+		},
+	}
+
+	for _, tt := range tests {
+		x, err := tt.get()
+		if tt.errorExpected == nil && err != nil {
+			t.Errorf("%s: received unexpected error: %s", tt.name, err.Error())
+		}
+
+		if tt.errorExpected != nil && !errors.Is(err, tt.errorExpected) {
+			t.Errorf("%s: expected error %s but got %v", tt.name, tt.errorExpected, err)
+		}
+
+		if x != tt.expected {
+			t.Errorf("%s: wrong value; expected %v but got %v", tt.name, tt.expected, x)
+		}
+	}
+
+	_, err = GetAs[string](c, "count")
+	var mismatch *TypeMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatal("expected a *TypeMismatchError")
+	}
+	if mismatch.Key != "count" || mismatch.Expected != "string" || mismatch.Actual != "int" {
+		t.Error("unexpected contents of TypeMismatchError:", mismatch)
+	}
+}
+
+func TestRememberAs(t *testing.T) {
+	c, err := New("buntdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	s, err := RememberAs(c, "greeting", time.Minute, func() (string, error) {
+		return "hello", nil
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	if s != "hello" {
+		t.Error("wrong value returned from RememberAs:", s)
+	}
+
+	_, err = RememberAs(c, "greeting", time.Minute, func() (int, error) {
+		return 1, nil
+	})
+	if !errors.Is(err, ErrTypeMismatch) {
+		t.Error("expected ErrTypeMismatch, got", err)
+	}
+}
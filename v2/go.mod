@@ -4,10 +4,15 @@ go 1.22
 
 require (
 	github.com/alicebob/miniredis/v2 v2.32.1
+	github.com/bradfitz/gomemcache v0.0.0-20230905024940-24af94b03874
 	github.com/dgraph-io/badger/v3 v3.2103.5
+	github.com/mattn/go-sqlite3 v1.14.22
 	github.com/redis/go-redis/v9 v9.5.3
 	github.com/tidwall/buntdb v1.3.1
 	github.com/tsawler/toolbox v1.3.1
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	go.etcd.io/bbolt v1.3.11
+	golang.org/x/sync v0.7.0
 )
 
 require (
@@ -32,6 +37,7 @@ require (
 	github.com/tidwall/pretty v1.2.1 // indirect
 	github.com/tidwall/rtred v0.1.2 // indirect
 	github.com/tidwall/tinyqueue v0.1.1 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
 	github.com/yuin/gopher-lua v1.1.1 // indirect
 	go.opencensus.io v0.24.0 // indirect
 	golang.org/x/net v0.26.0 // indirect
@@ -0,0 +1,373 @@
+// Package cachetest holds the tests which every remember backend must pass, so that each backend's own
+// tests need only cover what is particular to it.
+package cachetest
+
+import (
+	"context"
+	"errors"
+	"github.com/tsawler/remember/v2"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Backend is a cache type the suite runs against.
+type Backend struct {
+	Name string
+
+	// New returns new, empty caches for a test. They are closed when the test ends.
+	New func(t *testing.T) Caches
+
+	// ShortTTL is the shortest expiry the backend honours. Zero means 20ms; Badger, which stores
+	// expiry in whole seconds, needs a second.
+	ShortTTL time.Duration
+}
+
+// Caches are the caches a single test runs against.
+type Caches struct {
+	Cache remember.CacheInterface // A cache with the prefix "test".
+	Other remember.CacheInterface // A cache on the same store with the prefix "other", or nil if the backend has no prefixes.
+
+	// Wait lets d pass. It is only needed for stores with their own clock, such as miniredis; nil
+	// means time.Sleep.
+	Wait func(d time.Duration)
+}
+
+// env is what each test in the suite is given.
+type env struct {
+	Caches
+	ttl time.Duration
+}
+
+// expire waits until entries written with e.ttl have expired.
+func (e env) expire() {
+	d := e.ttl + e.ttl/2
+	if e.Wait != nil {
+		e.Wait(d)
+		return
+	}
+	time.Sleep(d)
+}
+
+// Run runs every test in the suite against each of backends, as subtests named after the backend.
+func Run(t *testing.T, backends []Backend) {
+	tests := []struct {
+		name string
+		fn   func(*testing.T, env)
+	}{
+		{"SetGet", testSetGet},
+		{"Expiry", testExpiry},
+		{"EmptyByMatch", testEmptyByMatch},
+		{"Many", testMany},
+		{"Increment", testIncrement},
+		{"TTL", testTTL},
+		{"Context", testContext},
+		{"Close", testClose},
+	}
+
+	for _, b := range backends {
+		ttl := b.ShortTTL
+		if ttl == 0 {
+			ttl = 20 * time.Millisecond
+		}
+
+		t.Run(b.Name, func(t *testing.T) {
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					tt.fn(t, env{Caches: b.New(t), ttl: ttl})
+				})
+			}
+		})
+	}
+}
+
+func testSetGet(t *testing.T, e env) {
+	cache := e.Cache
+	tests := []struct {
+		name  string
+		key   string
+		value any
+	}{
+		{"string", "foo", "bar"},
+		{"int", "answer", 42},
+		{"overwrite", "foo", "baz"},
+		{"key with spaces", "a key with spaces", "spaces"},
+		{"path-like key", "../../etc/passwd", "safe"},
+		{"long key", strings.Repeat("k", 300), "long"},
+	}
+
+	for _, tt := range tests {
+		err := cache.Set(tt.key, tt.value)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		val, err := cache.Get(tt.key)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		}
+		if val != tt.value {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.value, val)
+		}
+	}
+
+	_, err := cache.Get("missing")
+	if !errors.Is(err, remember.ErrNotFound) {
+		t.Error("expected ErrNotFound, got", err)
+	}
+
+	err = cache.Forget("foo")
+	if err != nil {
+		t.Error(err)
+	}
+	if cache.Has("foo") {
+		t.Error("foo still in cache after Forget")
+	}
+	if err := cache.Forget("missing"); err != nil {
+		t.Error("expected no error forgetting a missing key, got", err)
+	}
+}
+
+func testExpiry(t *testing.T, e env) {
+	cache := e.Cache
+	_ = cache.Set("short", "lived", e.ttl)
+	_ = cache.Set("kept", "value")
+	if !cache.Has("short") {
+		t.Error("expected key before it expires")
+	}
+
+	e.expire()
+	_, err := cache.Get("short")
+	if !errors.Is(err, remember.ErrNotFound) {
+		t.Error("expected an expired key to be reported as ErrNotFound, got", err)
+	}
+	if cache.Has("short") {
+		t.Error("expected Has to be false once the key has expired")
+	}
+	if !cache.Has("kept") {
+		t.Error("a key without an expiry expired")
+	}
+}
+
+func testEmptyByMatch(t *testing.T, e env) {
+	cache, other := e.Cache, e.Other
+	_ = cache.SetMany(map[string]any{"user:1": "a", "user:2": "b", "users": "c", "post:1": "d"})
+	if other != nil {
+		_ = other.Set("user:1", "untouched")
+	}
+
+	err := cache.EmptyByMatch("user:")
+	if err != nil {
+		t.Error(err)
+	}
+	for key, expected := range map[string]bool{"user:1": false, "user:2": false, "users": true, "post:1": true} {
+		if cache.Has(key) != expected {
+			t.Errorf("expected Has(%q) to be %t after EmptyByMatch", key, expected)
+		}
+	}
+	if other != nil && !other.Has("user:1") {
+		t.Error("EmptyByMatch removed a key belonging to another prefix")
+	}
+
+	_ = cache.Set("user:1", "new")
+	if val, _ := cache.GetString("user:1"); val != "new" {
+		t.Error("expected a key written after EmptyByMatch to be visible, got", val)
+	}
+
+	err = cache.Empty()
+	if err != nil {
+		t.Error(err)
+	}
+	values, _ := cache.GetMany([]string{"user:1", "users", "post:1"})
+	if len(values) != 0 {
+		t.Error("expected no values after Empty, got", values)
+	}
+	if other != nil && !other.Has("user:1") {
+		t.Error("Empty removed a key belonging to another prefix")
+	}
+
+	_ = cache.Set("after", "empty")
+	if !cache.Has("after") {
+		t.Error("expected to be able to write after Empty")
+	}
+}
+
+func testMany(t *testing.T, e env) {
+	cache := e.Cache
+	err := cache.SetMany(map[string]any{"a": "one", "b": 2, "c": "three"}, time.Minute)
+	if err != nil {
+		t.Error(err)
+	}
+
+	values, err := cache.GetMany([]string{"a", "b", "missing"})
+	if err != nil {
+		t.Error(err)
+	}
+	if len(values) != 2 || values["a"] != "one" || values["b"] != 2 {
+		t.Error("unexpected values from GetMany:", values)
+	}
+
+	err = cache.ForgetMany([]string{"a", "b", "missing"})
+	if err != nil {
+		t.Error(err)
+	}
+	if cache.Has("a") || cache.Has("b") || !cache.Has("c") {
+		t.Error("ForgetMany removed the wrong keys")
+	}
+
+	values, err = cache.GetMany(nil)
+	if err != nil || len(values) != 0 {
+		t.Error("expected an empty result for no keys, got", values, err)
+	}
+}
+
+func testIncrement(t *testing.T, e env) {
+	cache := e.Cache
+	n, err := cache.Decrement("counter", 5)
+	if err != nil || n != -5 {
+		t.Error("expected -5, got", n, err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.Increment("counter", 1); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	val, err := cache.GetInt("counter")
+	if err != nil || val != 15 {
+		t.Error("expected 15 after concurrent increments, got", val, err)
+	}
+
+	_ = cache.Set("text", "not a number")
+	_, err = cache.Increment("text", 1)
+	if !errors.Is(err, remember.ErrNotInteger) {
+		t.Error("expected ErrNotInteger, got", err)
+	}
+
+	_, _ = cache.Increment("short", 1, e.ttl)
+	e.expire()
+	n, _ = cache.Increment("short", 1)
+	if n != 1 {
+		t.Error("expected an expired counter to restart, got", n)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		n, err := cache.Increment("instant", 3, time.Nanosecond)
+		if err != nil || n != 3 {
+			t.Error("expected 3 from a counter which expires at once, got", n, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Increment did not return for a counter which expires at once")
+	}
+
+	_ = cache.EmptyByMatch("count")
+	n, _ = cache.Increment("counter", 1)
+	if n != 1 {
+		t.Error("expected counter to restart after EmptyByMatch, got", n)
+	}
+}
+
+func testTTL(t *testing.T, e env) {
+	cache := e.Cache
+	_ = cache.Set("forever", "value")
+	ttl, err := cache.TTL("forever")
+	if err != nil || ttl != remember.NoExpiration {
+		t.Error("expected NoExpiration, got", ttl, err)
+	}
+
+	err = cache.Touch("forever", time.Hour)
+	if err != nil {
+		t.Error(err)
+	}
+	ttl, _ = cache.TTL("forever")
+	if ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Error("expected a TTL of about an hour, got", ttl)
+	}
+
+	err = cache.Persist("forever")
+	if err != nil {
+		t.Error(err)
+	}
+	ttl, _ = cache.TTL("forever")
+	if ttl != remember.NoExpiration {
+		t.Error("expected NoExpiration after Persist, got", ttl)
+	}
+	if val, _ := cache.GetString("forever"); val != "value" {
+		t.Error("expected value to survive Touch and Persist, got", val)
+	}
+
+	_, _ = cache.Increment("counter", 1, time.Minute)
+	ttl, _ = cache.TTL("counter")
+	if ttl <= 0 || ttl > time.Minute {
+		t.Error("expected a new counter to expire within a minute, got", ttl)
+	}
+
+	if _, err := cache.TTL("missing"); !errors.Is(err, remember.ErrNotFound) {
+		t.Error("expected ErrNotFound from TTL, got", err)
+	}
+	if err := cache.Touch("missing", time.Hour); !errors.Is(err, remember.ErrNotFound) {
+		t.Error("expected ErrNotFound from Touch, got", err)
+	}
+	if err := cache.Persist("missing"); !errors.Is(err, remember.ErrNotFound) {
+		t.Error("expected ErrNotFound from Persist, got", err)
+	}
+}
+
+func testContext(t *testing.T, e env) {
+	cache := e.Cache
+	c, ok := cache.(remember.ContextCacheInterface)
+	if !ok {
+		t.Fatalf("%T does not implement ContextCacheInterface", cache)
+	}
+
+	ctx := context.Background()
+	if err := c.SetCtx(ctx, "foo", "bar"); err != nil {
+		t.Error(err)
+	}
+	if val, err := c.GetCtx(ctx, "foo"); err != nil || val != "bar" {
+		t.Error("expected bar, got", val, err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := c.SetCtx(canceled, "foo", "baz"); !errors.Is(err, context.Canceled) {
+		t.Error("expected context.Canceled from SetCtx, got", err)
+	}
+	if c.HasCtx(canceled, "foo") {
+		t.Error("expected HasCtx to be false once the context is done")
+	}
+
+	if err := c.ForgetCtx(ctx, "foo"); err != nil {
+		t.Error(err)
+	}
+	if c.Has("foo") {
+		t.Error("foo still in cache after ForgetCtx")
+	}
+}
+
+func testClose(t *testing.T, e env) {
+	cache := e.Cache
+	err := cache.Close()
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = cache.Set("foo", "bar")
+	if !errors.Is(err, remember.ErrClosed) {
+		t.Error("expected ErrClosed, got", err)
+	}
+}
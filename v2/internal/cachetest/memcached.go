@@ -0,0 +1,201 @@
+package cachetest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memcachedMaxRelativeExpiry is the longest expiry memcached treats as relative.
+const memcachedMaxRelativeExpiry = 30 * 24 * time.Hour
+
+// Memcached is a small in-process server speaking the parts of the memcached text protocol used by
+// the memcached package: gets, set, add, cas, delete and touch.
+type Memcached struct {
+	mu    sync.Mutex
+	items map[string]*memcachedItem
+	cas   uint64
+	reads int // The number of keys requested by get and gets.
+	ln    net.Listener
+}
+
+type memcachedItem struct {
+	value     []byte
+	flags     uint32
+	expiresAt time.Time
+	cas       uint64
+}
+
+// StartMemcached starts a Memcached, which is stopped when the test ends.
+func StartMemcached(t *testing.T) *Memcached {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Memcached{items: make(map[string]*memcachedItem), ln: ln}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go m.serve(conn)
+		}
+	}()
+	return m
+}
+
+// Addr returns the host:port the server is listening on.
+func (m *Memcached) Addr() string {
+	return m.ln.Addr().String()
+}
+
+// Reads returns the number of keys requested by get and gets.
+func (m *Memcached) Reads() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.reads
+}
+
+func (m *Memcached) serve(conn net.Conn) {
+	defer conn.Close()
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+
+	for {
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var reply string
+		switch fields[0] {
+		case "gets", "get":
+			reply = m.get(fields[1:])
+		case "set", "add", "cas":
+			n, _ := strconv.Atoi(fields[4])
+			data := make([]byte, n+2)
+			if _, err := io.ReadFull(rw, data); err != nil {
+				return
+			}
+			reply = m.store(fields, data[:n])
+		case "delete":
+			reply = m.delete(fields[1])
+		case "touch":
+			reply = m.touch(fields[1], fields[2])
+		default:
+			reply = "ERROR\r\n"
+		}
+
+		_, _ = rw.WriteString(reply)
+		_ = rw.Flush()
+	}
+}
+
+// lookup returns the live item at key. The lock must be held.
+func (m *Memcached) lookup(key string) (*memcachedItem, bool) {
+	item, ok := m.items[key]
+	if ok && !item.expiresAt.IsZero() && !time.Now().Before(item.expiresAt) {
+		delete(m.items, key)
+		return nil, false
+	}
+	return item, ok
+}
+
+func (m *Memcached) get(keys []string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.reads += len(keys)
+	var b strings.Builder
+	for _, key := range keys {
+		if item, ok := m.lookup(key); ok {
+			fmt.Fprintf(&b, "VALUE %s %d %d %d\r\n%s\r\n", key, item.flags, len(item.value), item.cas, item.value)
+		}
+	}
+	b.WriteString("END\r\n")
+	return b.String()
+}
+
+func (m *Memcached) store(fields []string, data []byte) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := fields[1]
+	flags, _ := strconv.ParseUint(fields[2], 10, 32)
+	existing, exists := m.lookup(key)
+
+	switch fields[0] {
+	case "add":
+		if exists {
+			return "NOT_STORED\r\n"
+		}
+	case "cas":
+		if !exists {
+			return "NOT_FOUND\r\n"
+		}
+		if cas, _ := strconv.ParseUint(fields[5], 10, 64); cas != existing.cas {
+			return "EXISTS\r\n"
+		}
+	}
+
+	m.cas++
+	m.items[key] = &memcachedItem{
+		value:     append([]byte(nil), data...),
+		flags:     uint32(flags),
+		expiresAt: memcachedExpiry(fields[3]),
+		cas:       m.cas,
+	}
+	return "STORED\r\n"
+}
+
+func (m *Memcached) delete(key string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.lookup(key); !ok {
+		return "NOT_FOUND\r\n"
+	}
+	delete(m.items, key)
+	return "DELETED\r\n"
+}
+
+func (m *Memcached) touch(key, exptime string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, ok := m.lookup(key)
+	if !ok {
+		return "NOT_FOUND\r\n"
+	}
+	item.expiresAt = memcachedExpiry(exptime)
+	return "TOUCHED\r\n"
+}
+
+// memcachedExpiry interprets an expiry the way memcached does.
+func memcachedExpiry(exptime string) time.Time {
+	secs, _ := strconv.ParseInt(exptime, 10, 64)
+	switch {
+	case secs == 0:
+		return time.Time{}
+	case secs < 0:
+		return time.Now()
+	case secs > int64(memcachedMaxRelativeExpiry/time.Second):
+		return time.Unix(secs, 0)
+	default:
+		return time.Now().Add(time.Duration(secs) * time.Second)
+	}
+}
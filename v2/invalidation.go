@@ -0,0 +1,121 @@
+package remember
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Invalidation describes a change made to a shared cache, so that other processes can evict any local
+// copies of the affected entries.
+type Invalidation struct {
+	Origin   string   `json:"origin"`             // Identifies the cache which made the change.
+	Keys     []string `json:"keys,omitempty"`     // Keys which were written or removed.
+	Prefixes []string `json:"prefixes,omitempty"` // Prefixes which were emptied. "" means everything.
+}
+
+// Invalidator is implemented by caches which can tell other processes about changes to entries.
+type Invalidator interface {
+	// Subscribe calls fn for every change made by other processes until ctx is done.
+	Subscribe(ctx context.Context, fn func(Invalidation)) error
+}
+
+// InvalidationChannel returns the Redis pub/sub channel on which this client publishes invalidations,
+// and to which Subscribe listens. It is derived from the prefix, so only clients sharing a prefix see
+// each other's changes.
+func (c *RedisCache) InvalidationChannel() string {
+	return c.Prefix + ":invalidations"
+}
+
+// origin returns the random identifier which marks invalidations published by this client.
+func (c *RedisCache) origin() string {
+	c.originOnce.Do(func() {
+		b := make([]byte, 16)
+		_, _ = rand.Read(b)
+		c.originID = hex.EncodeToString(b)
+	})
+	return c.originID
+}
+
+// publish sends inv to the invalidation channel, if invalidation is enabled.
+func (c *RedisCache) publish(ctx context.Context, inv Invalidation) error {
+	if !c.Invalidation {
+		return nil
+	}
+
+	inv.Origin = c.origin()
+	msg, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+
+	return wrapError(c.Conn.Publish(ctx, c.InvalidationChannel(), msg).Err())
+}
+
+// Subscribe listens for invalidations published by other clients sharing this prefix, and calls fn
+// for each one until ctx is done. Invalidations published by this client are skipped. It returns once
+// the subscription is established. If the connection to Redis is lost, the subscription is restored
+// automatically; because changes made in the meantime are lost, fn is then called with an
+// Invalidation of the prefix "", telling the subscriber to drop everything.
+func (c *RedisCache) Subscribe(ctx context.Context, fn func(Invalidation)) error {
+	pubsub := c.Conn.Subscribe(ctx, c.InvalidationChannel())
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return wrapError(err)
+	}
+
+	messages := pubsub.ChannelWithSubscriptions()
+
+	go func() {
+		defer pubsub.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+
+				switch m := msg.(type) {
+				case *redis.Subscription:
+					if m.Kind == "subscribe" {
+						fn(Invalidation{Prefixes: []string{""}})
+					}
+
+				case *redis.Message:
+					var inv Invalidation
+					if err := json.Unmarshal([]byte(m.Payload), &inv); err != nil || inv.Origin == c.origin() {
+						continue
+					}
+					fn(inv)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Listen subscribes to invalidations from L2, evicting the affected entries from L1 until ctx is
+// done, so that changes made by other processes are seen immediately rather than once the L1 copy
+// expires. L2 must implement Invalidator; for a RedisCache, the writers must have Invalidation set.
+func (t *TieredCache) Listen(ctx context.Context) error {
+	inv, ok := t.L2.(Invalidator)
+	if !ok {
+		return errors.New("the second tier does not support invalidation")
+	}
+
+	return inv.Subscribe(ctx, func(i Invalidation) {
+		_ = t.L1.ForgetMany(i.Keys)
+		for _, prefix := range i.Prefixes {
+			_ = t.L1.EmptyByMatch(prefix)
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package remember
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestInvalidatingTier(t *testing.T, s *miniredis.Miniredis) *TieredCache {
+	l1, _ := New("memory")
+	l2, err := New("redis", &Options{
+		Server:       s.Host(),
+		Port:         s.Port(),
+		Prefix:       "test_invalidation",
+		Invalidation: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewTiered(l1.(*MemoryCache), l2, time.Hour)
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+// waitFor polls cond until it is true or a second has passed.
+func waitFor(cond func() bool) bool {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return cond()
+}
+
+func TestTieredCache_Listen(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	podA := newTestInvalidatingTier(t, testRedis)
+	podB := newTestInvalidatingTier(t, testRedis)
+
+	err := podA.Listen(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = podA.Set("user", "old")
+	_ = podA.Set("fooa", "x")
+	_ = podA.Set("bar", "x")
+
+	_ = podB.Set("user", "new")
+	if !waitFor(func() bool { return !podA.L1.Has("user") }) {
+		t.Fatal("L1 entry was not invalidated by a Set in another process")
+	}
+
+	x, _ := podA.Get("user")
+	if x != "new" {
+		t.Error("expected the new value after invalidation, got", x)
+	}
+
+	_ = podB.EmptyByMatch("foo")
+	if !waitFor(func() bool { return !podA.L1.Has("fooa") }) {
+		t.Error("L1 entry was not invalidated by an EmptyByMatch in another process")
+	}
+	if !podA.L1.Has("bar") {
+		t.Error("invalidation removed an entry which does not match the prefix")
+	}
+
+	// A cache's own changes are not echoed back to it.
+	_ = podA.Set("mine", "x")
+	time.Sleep(20 * time.Millisecond)
+	if !podA.L1.Has("mine") {
+		t.Error("a cache's own Set should not invalidate its L1 copy")
+	}
+
+	_ = podA.Empty()
+}
+
+func TestRedisCache_SubscribeReconnect(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ops := &Options{Server: s.Host(), Port: s.Port(), Prefix: "test_reconnect", Invalidation: true}
+	subscriber, _ := New("redis", ops)
+	publisher, _ := New("redis", ops)
+	defer subscriber.Close()
+	defer publisher.Close()
+
+	var mu sync.Mutex
+	var received []Invalidation
+	seen := func(match func(Invalidation) bool) func() bool {
+		return func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, inv := range received {
+				if match(inv) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err = subscriber.(Invalidator).Subscribe(ctx, func(inv Invalidation) {
+		mu.Lock()
+		received = append(received, inv)
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = publisher.Set("before", "x")
+	if !waitFor(seen(func(inv Invalidation) bool { return len(inv.Keys) == 1 && inv.Keys[0] == "before" })) {
+		t.Fatal("did not receive invalidation before reconnect")
+	}
+
+	s.Close()
+	err = s.Restart()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !waitFor(seen(func(inv Invalidation) bool { return len(inv.Prefixes) == 1 && inv.Prefixes[0] == "" })) {
+		t.Fatal("did not receive a full invalidation after reconnecting")
+	}
+
+	_ = publisher.Set("after", "x")
+	if !waitFor(seen(func(inv Invalidation) bool { return len(inv.Keys) == 1 && inv.Keys[0] == "after" })) {
+		t.Error("did not receive invalidation after reconnect")
+	}
+}
@@ -0,0 +1,445 @@
+package remember
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/redis/go-redis/v9"
+	"github.com/tidwall/buntdb"
+)
+
+var (
+	// ErrLocked is returned by TryLock when the lock is held by someone else.
+	ErrLocked = errors.New("lock is held by another owner")
+
+	// ErrLockLost is returned by Release and Extend when the lock has expired, and may since have
+	// been acquired by someone else.
+	ErrLockLost = errors.New("lock is no longer held")
+)
+
+// lockRetryInterval is how often Lock retries a lock which is held by someone else.
+const lockRetryInterval = 50 * time.Millisecond
+
+// lockSpace follows the prefix in the keys of Badger and BuntDB locks and fencing counters. Entries are
+// stored as "prefix:key", or as the bare key when the prefix is empty, and Empty and EmptyByMatch skip
+// keys starting with the prefix and lockSpace, so that emptying a cache never releases its locks or
+// restarts their tokens.
+const lockSpace = "\x00locks:"
+
+// Locker is implemented by caches which provide mutual exclusion between processes, for example to
+// stop a scheduled job from running on two hosts at once. Every acquisition of a name returns a
+// fencing token greater than any returned before for that name, so that a store guarded by the lock
+// can reject writes from a holder whose lock has expired.
+type Locker interface {
+	// Lock acquires the named lock for ttl, waiting for as long as it is held by someone else.
+	Lock(name string, ttl time.Duration) (*Lock, error)
+
+	// LockCtx acquires the named lock for ttl, waiting until it is free or ctx is done.
+	LockCtx(ctx context.Context, name string, ttl time.Duration) (*Lock, error)
+
+	// TryLock acquires the named lock for ttl, or returns ErrLocked if it is held by someone else.
+	TryLock(name string, ttl time.Duration) (*Lock, error)
+}
+
+// lockStore is implemented by the backends which support locks. Each holder is identified by a
+// random owner string, so that only the holder can release or extend a lock.
+type lockStore interface {
+	acquireLock(name, owner string, ttl time.Duration) (token int64, ok bool, err error)
+	releaseLock(name, owner string) (bool, error)
+	extendLock(name, owner string, ttl time.Duration) (bool, error)
+}
+
+// Lock is a held lock. The lock is released by Release, or when its ttl passes, whichever comes first.
+type Lock struct {
+	Name  string
+	Token int64 // The fencing token, which increases with every acquisition of Name.
+	store lockStore
+	owner string
+}
+
+// Release releases the lock. It returns ErrLockLost if the lock had already expired.
+func (l *Lock) Release() error {
+	ok, err := l.store.releaseLock(l.Name, l.owner)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrLockLost, l.Name)
+	}
+	return nil
+}
+
+// Extend sets the time remaining before the lock expires to ttl, for holders which need longer than
+// they first asked for. It returns ErrLockLost if the lock had already expired.
+func (l *Lock) Extend(ttl time.Duration) error {
+	if ttl < time.Millisecond {
+		return fmt.Errorf("%w: lock ttl must be at least a millisecond", ErrInvalidOptions)
+	}
+
+	ok, err := l.store.extendLock(l.Name, l.owner, ttl)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrLockLost, l.Name)
+	}
+	return nil
+}
+
+// tryLock implements TryLock for any lockStore.
+func tryLock(s lockStore, name string, ttl time.Duration) (*Lock, error) {
+	if ttl < time.Millisecond {
+		return nil, fmt.Errorf("%w: lock ttl must be at least a millisecond", ErrInvalidOptions)
+	}
+
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	owner := hex.EncodeToString(b)
+
+	token, ok, err := s.acquireLock(name, owner, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrLocked, name)
+	}
+	return &Lock{Name: name, Token: token, store: s, owner: owner}, nil
+}
+
+// lock implements LockCtx for any lockStore, by retrying tryLock until it succeeds or ctx is done.
+func lock(ctx context.Context, s lockStore, name string, ttl time.Duration) (*Lock, error) {
+	ticker := time.NewTicker(lockRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		l, err := tryLock(s, name, ttl)
+		if !errors.Is(err, ErrLocked) {
+			return l, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// acquireScript sets the lock to the owner if it is free, and if so returns the next fencing token,
+// or 0 otherwise.
+var acquireScript = redis.NewScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return redis.call('INCR', KEYS[2])
+end
+return 0
+`)
+
+// releaseScript deletes the lock if it is held by the owner.
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// extendScript sets the lock's expiry if it is held by the owner.
+var extendScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// Lock acquires the named lock for ttl, waiting for as long as it is held by someone else.
+func (c *RedisCache) Lock(name string, ttl time.Duration) (*Lock, error) {
+	return lock(context.Background(), c, name, ttl)
+}
+
+// LockCtx acquires the named lock for ttl, waiting until it is free or ctx is done.
+func (c *RedisCache) LockCtx(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	return lock(ctx, c, name, ttl)
+}
+
+// TryLock acquires the named lock for ttl with SET NX PX, or returns ErrLocked if it is held by
+// someone else. The fencing token is an INCR of a counter kept alongside the lock, which never
+// expires and, being outside the prefix, is not removed by Empty.
+func (c *RedisCache) TryLock(name string, ttl time.Duration) (*Lock, error) {
+	return tryLock(c, name, ttl)
+}
+
+// lockKeys returns the keys of the named lock and of its fencing counter. They share a hash tag, so
+// that they are in the same slot in cluster mode.
+func (c *RedisCache) lockKeys(name string) []string {
+	return []string{c.Prefix + "#lock:{" + name + "}", c.Prefix + "#fence:{" + name + "}"}
+}
+
+func (c *RedisCache) acquireLock(name, owner string, ttl time.Duration) (int64, bool, error) {
+	token, err := acquireScript.Run(context.Background(), c.Conn, c.lockKeys(name), owner, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return 0, false, wrapError(err)
+	}
+	return token, token > 0, nil
+}
+
+func (c *RedisCache) releaseLock(name, owner string) (bool, error) {
+	n, err := releaseScript.Run(context.Background(), c.Conn, c.lockKeys(name)[:1], owner).Int64()
+	if err != nil {
+		return false, wrapError(err)
+	}
+	return n == 1, nil
+}
+
+func (c *RedisCache) extendLock(name, owner string, ttl time.Duration) (bool, error) {
+	n, err := extendScript.Run(context.Background(), c.Conn, c.lockKeys(name)[:1], owner, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return false, wrapError(err)
+	}
+	return n == 1, nil
+}
+
+// Lock acquires the named lock for ttl, waiting for as long as it is held by someone else.
+func (b *BadgerCache) Lock(name string, ttl time.Duration) (*Lock, error) {
+	return lock(context.Background(), b, name, ttl)
+}
+
+// LockCtx acquires the named lock for ttl, waiting until it is free or ctx is done.
+func (b *BadgerCache) LockCtx(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	return lock(ctx, b, name, ttl)
+}
+
+// TryLock acquires the named lock for ttl in a transaction, or returns ErrLocked if it is held by
+// someone else. Locks only exclude processes sharing the database, which Badger limits to one. The
+// lock records its own expiry, since Badger's is only accurate to the second.
+func (b *BadgerCache) TryLock(name string, ttl time.Duration) (*Lock, error) {
+	return tryLock(b, name, ttl)
+}
+
+// lockKeys returns the keys of the named lock and of its fencing counter.
+func (b *BadgerCache) lockKeys(name string) ([]byte, []byte) {
+	return []byte(b.Prefix + lockSpace + "lock:" + name), []byte(b.Prefix + lockSpace + "fence:" + name)
+}
+
+// lockOwner returns the owner of the lock stored in item, or "" if it has expired.
+func lockOwner(item *badger.Item) (string, error) {
+	val, err := item.ValueCopy(nil)
+	if err != nil {
+		return "", err
+	}
+	if len(val) < 8 || int64(binary.BigEndian.Uint64(val)) <= time.Now().UnixNano() {
+		return "", nil
+	}
+	return string(val[8:]), nil
+}
+
+// lockEntry returns the entry which records that owner holds the lock at key for ttl.
+func lockEntry(key []byte, owner string, ttl time.Duration) *badger.Entry {
+	expiresAt := time.Now().Add(ttl)
+	val := binary.BigEndian.AppendUint64(nil, uint64(expiresAt.UnixNano()))
+	return &badger.Entry{Key: key, Value: append(val, owner...), ExpiresAt: uint64(expiresAt.Unix()) + 1}
+}
+
+// updateLock runs fn in a transaction, retrying it if it conflicts with another.
+func (b *BadgerCache) updateLock(fn func(txn *badger.Txn) error) error {
+	for {
+		err := b.Conn.Update(fn)
+		if err == badger.ErrConflict {
+			continue
+		}
+		return wrapError(err)
+	}
+}
+
+func (b *BadgerCache) acquireLock(name, owner string, ttl time.Duration) (int64, bool, error) {
+	lockKey, fenceKey := b.lockKeys(name)
+
+	var token int64
+	err := b.updateLock(func(txn *badger.Txn) error {
+		token = 0
+		item, err := txn.Get(lockKey)
+		if err != nil && err != badger.ErrKeyNotFound {
+			return err
+		}
+		if err == nil {
+			// A lock which is still held leaves token at 0.
+			holder, err := lockOwner(item)
+			if err != nil || holder != "" {
+				return err
+			}
+		}
+
+		item, err = txn.Get(fenceKey)
+		switch {
+		case err == badger.ErrKeyNotFound:
+		case err != nil:
+			return err
+		default:
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if token, err = ParseCounter(string(fenceKey), val); err != nil {
+				return err
+			}
+		}
+
+		token++
+		if err := txn.Set(fenceKey, FormatCounter(token)); err != nil {
+			return err
+		}
+		return txn.SetEntry(lockEntry(lockKey, owner, ttl))
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	return token, token > 0, nil
+}
+
+func (b *BadgerCache) releaseLock(name, owner string) (bool, error) {
+	lockKey, _ := b.lockKeys(name)
+
+	var held bool
+	err := b.updateLock(func(txn *badger.Txn) error {
+		held = false
+		item, err := txn.Get(lockKey)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		holder, err := lockOwner(item)
+		if err != nil || holder != owner {
+			return err
+		}
+
+		held = true
+		return txn.Delete(lockKey)
+	})
+	return held, err
+}
+
+func (b *BadgerCache) extendLock(name, owner string, ttl time.Duration) (bool, error) {
+	lockKey, _ := b.lockKeys(name)
+
+	var held bool
+	err := b.updateLock(func(txn *badger.Txn) error {
+		held = false
+		item, err := txn.Get(lockKey)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		holder, err := lockOwner(item)
+		if err != nil || holder != owner {
+			return err
+		}
+
+		held = true
+		return txn.SetEntry(lockEntry(lockKey, owner, ttl))
+	})
+	return held, err
+}
+
+// Lock acquires the named lock for ttl, waiting for as long as it is held by someone else.
+func (b *BuntDBCache) Lock(name string, ttl time.Duration) (*Lock, error) {
+	return lock(context.Background(), b, name, ttl)
+}
+
+// LockCtx acquires the named lock for ttl, waiting until it is free or ctx is done.
+func (b *BuntDBCache) LockCtx(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	return lock(ctx, b, name, ttl)
+}
+
+// TryLock acquires the named lock for ttl in a transaction, or returns ErrLocked if it is held by
+// someone else. Locks only exclude users of the same database, so they are for use on a single host.
+func (b *BuntDBCache) TryLock(name string, ttl time.Duration) (*Lock, error) {
+	return tryLock(b, name, ttl)
+}
+
+// lockKeys returns the keys of the named lock and of its fencing counter.
+func (b *BuntDBCache) lockKeys(name string) (string, string) {
+	return b.Prefix + lockSpace + "lock:" + name, b.Prefix + lockSpace + "fence:" + name
+}
+
+func (b *BuntDBCache) acquireLock(name, owner string, ttl time.Duration) (int64, bool, error) {
+	lockKey, fenceKey := b.lockKeys(name)
+
+	var token int64
+	err := b.Conn.Update(func(tx *buntdb.Tx) error {
+		// Expired locks are reported as not found. A lock which is still held leaves token at 0.
+		_, err := tx.Get(lockKey)
+		if err != buntdb.ErrNotFound {
+			return err
+		}
+
+		val, err := tx.Get(fenceKey)
+		switch {
+		case err == buntdb.ErrNotFound:
+		case err != nil:
+			return err
+		default:
+			if token, err = ParseCounter(fenceKey, []byte(val)); err != nil {
+				return err
+			}
+		}
+
+		token++
+		if _, _, err := tx.Set(fenceKey, string(FormatCounter(token)), nil); err != nil {
+			return err
+		}
+		_, _, err = tx.Set(lockKey, owner, &buntdb.SetOptions{Expires: true, TTL: ttl})
+		return err
+	})
+	if err != nil {
+		return 0, false, wrapError(err)
+	}
+	return token, token > 0, nil
+}
+
+func (b *BuntDBCache) releaseLock(name, owner string) (bool, error) {
+	lockKey, _ := b.lockKeys(name)
+
+	var held bool
+	err := b.Conn.Update(func(tx *buntdb.Tx) error {
+		val, err := tx.Get(lockKey)
+		if err == buntdb.ErrNotFound {
+			return nil
+		}
+		if err != nil || val != owner {
+			return err
+		}
+
+		held = true
+		_, err = tx.Delete(lockKey)
+		return err
+	})
+	return held, wrapError(err)
+}
+
+func (b *BuntDBCache) extendLock(name, owner string, ttl time.Duration) (bool, error) {
+	lockKey, _ := b.lockKeys(name)
+
+	var held bool
+	err := b.Conn.Update(func(tx *buntdb.Tx) error {
+		val, err := tx.Get(lockKey)
+		if err == buntdb.ErrNotFound {
+			return nil
+		}
+		if err != nil || val != owner {
+			return err
+		}
+
+		held = true
+		_, _, err = tx.Set(lockKey, owner, &buntdb.SetOptions{Expires: true, TTL: ttl})
+		return err
+	})
+	return held, wrapError(err)
+}
@@ -0,0 +1,151 @@
+package remember
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLocker(t *testing.T) {
+	backends, s := newTestBackends(t)
+
+	for _, tt := range backends {
+		locker := tt.cache.(Locker)
+
+		first, err := locker.TryLock("job", time.Minute)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+
+		_, err = locker.TryLock("job", time.Minute)
+		if !errors.Is(err, ErrLocked) {
+			t.Errorf("%s: expected ErrLocked while the lock is held, got %v", tt.name, err)
+		}
+
+		if err := first.Extend(time.Hour); err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		}
+		if err := first.Release(); err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		}
+		if err := first.Release(); !errors.Is(err, ErrLockLost) {
+			t.Errorf("%s: expected ErrLockLost releasing twice, got %v", tt.name, err)
+		}
+
+		second, err := locker.TryLock("job", 100*time.Millisecond)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if second.Token <= first.Token {
+			t.Errorf("%s: expected fencing token to increase, got %d then %d", tt.name, first.Token, second.Token)
+		}
+
+		// Lock waits for the held lock to expire.
+		if tt.name == "redis" {
+			go func() {
+				time.Sleep(20 * time.Millisecond)
+				s.FastForward(time.Second)
+			}()
+		}
+		third, err := locker.Lock("job", time.Minute)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if third.Token <= second.Token {
+			t.Errorf("%s: expected fencing token to increase, got %d then %d", tt.name, second.Token, third.Token)
+		}
+		if err := second.Extend(time.Minute); !errors.Is(err, ErrLockLost) {
+			t.Errorf("%s: expected ErrLockLost extending an expired lock, got %v", tt.name, err)
+		}
+		if err := second.Release(); !errors.Is(err, ErrLockLost) {
+			t.Errorf("%s: expected the expired holder not to release the new holder's lock, got %v", tt.name, err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		_, err = locker.LockCtx(ctx, "job", time.Minute)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: expected LockCtx to stop when ctx is done, got %v", tt.name, err)
+		}
+
+		if _, err := locker.TryLock("other", 0); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("%s: expected ErrInvalidOptions for a zero ttl, got %v", tt.name, err)
+		}
+
+		if err := third.Release(); err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		}
+
+		// Emptying the cache neither releases locks nor restarts tokens.
+		fourth, err := locker.TryLock("job", time.Minute)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if err := tt.cache.Empty(); err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		}
+		if _, err := locker.TryLock("job", time.Minute); !errors.Is(err, ErrLocked) {
+			t.Errorf("%s: expected the lock to survive Empty, got %v", tt.name, err)
+		}
+		_ = fourth.Release()
+		fifth, err := locker.TryLock("job", time.Minute)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if fifth.Token <= fourth.Token {
+			t.Errorf("%s: expected fencing token to increase across Empty, got %d then %d", tt.name, fourth.Token, fifth.Token)
+		}
+		_ = fifth.Release()
+	}
+}
+
+func TestLocker_Concurrent(t *testing.T) {
+	backends, _ := newTestBackends(t)
+
+	for _, tt := range backends {
+		testLockerConcurrent(t, tt.cache.(Locker))
+	}
+}
+
+// testLockerConcurrent checks that concurrent holders of one lock exclude each other.
+func testLockerConcurrent(t *testing.T, locker Locker) {
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	held := 0
+	tokens := make(map[int64]bool)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			l, err := locker.Lock("counter", time.Minute)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			mu.Lock()
+			held++
+			if held > 1 {
+				t.Error("lock was held by more than one goroutine")
+			}
+			tokens[l.Token] = true
+			mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mu.Lock()
+			held--
+			mu.Unlock()
+			_ = l.Release()
+		}()
+	}
+	wg.Wait()
+
+	if len(tokens) != 10 {
+		t.Error("expected a distinct token for every holder, got", len(tokens))
+	}
+}
@@ -0,0 +1,698 @@
+// Package memcached provides a remember cache stored in memcached. Importing it registers the
+// "memcached" cache type with remember.New.
+package memcached
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/tsawler/remember/v2"
+	"golang.org/x/sync/singleflight"
+	"hash/fnv"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Cache is the type for a memcached cache. Memcached cannot list its keys, so Empty and EmptyByMatch
+// are emulated with namespace generations, kept in a single index item per Prefix: a generation for
+// the whole namespace, and one for each prefix which EmptyByMatch has emptied. A value is only visible
+// while the generations it was written under are unchanged. Emptying a prefix moves its generation on,
+// which hides the affected values until memcached evicts or expires them; Empty starts a new
+// namespace, which also forgets the emptied prefixes. So that the index stays small, emptying a prefix
+// forgets the longer prefixes it covers, and once maxMatches prefixes are held, EmptyByMatch starts a
+// new namespace too, hiding every value.
+//
+// The index is read with every operation, in the same round trip as the values. If memcached evicts
+// it, a new namespace is started, so every value written before becomes invisible rather than
+// reappearing.
+type Cache struct {
+	Conn     *memcache.Client
+	Prefix   string
+	Codec    remember.Codec // The codec used to serialize values. Defaults to remember.GobCodec.
+	KeepOpen bool           // If true, Close leaves Conn open, for clients owned by the caller.
+	group    singleflight.Group
+	closed   atomic.Bool
+}
+
+const (
+	// maxKeyLength is the longest key memcached accepts.
+	maxKeyLength = 250
+
+	// maxRelativeExpiry is the longest expiry memcached treats as relative; anything longer must be
+	// given as a Unix time.
+	maxRelativeExpiry = 30 * 24 * time.Hour
+
+	// headerSize is the length of the expiry stored in front of every value.
+	headerSize = 8
+
+	// maxMatches is the most emptied prefixes a namespace index holds.
+	maxMatches = 100
+)
+
+// defaultServer is used when Options.MemcachedServers is empty.
+const defaultServer = "localhost:11211"
+
+func init() {
+	_ = remember.Register("memcached", func(ops *remember.Options) (remember.CacheInterface, error) {
+		cache, err := newCache(ops)
+		if err != nil {
+			return nil, err
+		}
+		return cache, nil
+	})
+}
+
+// New returns a memcached cache configured by opts. It uses localhost:11211 unless WithServers is
+// given.
+func New(opts ...remember.Option) (*Cache, error) {
+	ops := &remember.Options{}
+	for _, opt := range opts {
+		opt(ops)
+	}
+	return newCache(ops)
+}
+
+// WithServers sets the memcached servers. Keys are spread across them.
+func WithServers(servers ...string) remember.Option {
+	return func(o *remember.Options) { o.MemcachedServers = servers }
+}
+
+// NewFromClient returns a cache which uses an existing memcached client, taking Prefix and Codec from
+// the optional options. Close leaves the client open unless KeepOpen is set to false.
+func NewFromClient(client *memcache.Client, o ...*remember.Options) *Cache {
+	ops := &remember.Options{}
+	if len(o) > 0 && o[0] != nil {
+		ops = o[0]
+	}
+	return &Cache{
+		Conn:     client,
+		Prefix:   ops.Prefix,
+		Codec:    ops.Codec,
+		KeepOpen: true,
+	}
+}
+
+// newCache fills in the default server, validates ops and returns a memcached cache which owns its
+// client.
+func newCache(o *remember.Options) (*Cache, error) {
+	ops := *o
+	if len(ops.MemcachedServers) == 0 {
+		ops.MemcachedServers = []string{defaultServer}
+	}
+	if err := validate(&ops); err != nil {
+		return nil, err
+	}
+
+	cache := NewFromClient(memcache.New(ops.MemcachedServers...), &ops)
+	cache.KeepOpen = false
+	return cache, nil
+}
+
+// validate reports every problem with the memcached servers in ops. Each problem wraps
+// remember.ErrInvalidOptions.
+func validate(ops *remember.Options) error {
+	var errs []error
+	for _, server := range ops.MemcachedServers {
+		if strings.HasPrefix(server, "/") {
+			continue // A Unix socket.
+		}
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			errs = append(errs, fmt.Errorf("%w: memcached server %q is not of the form host:port", remember.ErrInvalidOptions, server))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes the memcached client's idle connections, unless KeepOpen is set. Any later operation
+// returns remember.ErrClosed.
+func (c *Cache) Close() error {
+	if c.KeepOpen {
+		return nil
+	}
+	if !c.closed.CompareAndSwap(false, true) {
+		return remember.ErrClosed
+	}
+	return c.Conn.Close()
+}
+
+// Has checks to see if the supplied key is in the cache and returns true if found, otherwise false.
+func (c *Cache) Has(key string) bool {
+	_, err := c.Get(key)
+	return err == nil
+}
+
+// Get attempts to retrieve a value from the cache.
+func (c *Cache) Get(key string) (any, error) {
+	items, sigs, err := c.fetch([]string{key}, true)
+	if err != nil {
+		return nil, err
+	}
+
+	_, payload, err := c.live(items[c.storageKey(key)], sigs[key])
+	if err != nil {
+		return nil, err
+	}
+	return remember.DecodeValue(payload)
+}
+
+// Set puts a value into the cache. The final parameter, expires, is optional.
+func (c *Cache) Set(key string, value any, expires ...time.Duration) error {
+	return c.SetMany(map[string]any{key: value}, expires...)
+}
+
+// Remember returns the value stored at key. If the key is not in the cache, fn is called to compute
+// the value, which is stored with the given ttl (0 means no expiry) and returned. Concurrent misses
+// for the same key share a single call to fn.
+func (c *Cache) Remember(key string, ttl time.Duration, fn func() (any, error)) (any, error) {
+	return remember.Remember(c, &c.group, key, ttl, fn)
+}
+
+// Forget removes an item from the cache, by key.
+func (c *Cache) Forget(key string) error {
+	if c.closed.Load() {
+		return remember.ErrClosed
+	}
+
+	err := c.Conn.Delete(c.storageKey(key))
+	if err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+		return err
+	}
+	return nil
+}
+
+// GetMany retrieves several values, and the generations they depend on, in a single round trip. Keys
+// which are not in the cache are omitted from the returned map.
+func (c *Cache) GetMany(keys []string) (map[string]any, error) {
+	result := make(map[string]any, len(keys))
+	if len(keys) == 0 {
+		return result, nil
+	}
+
+	items, sigs, err := c.fetch(keys, true)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		_, payload, err := c.live(items[c.storageKey(key)], sigs[key])
+		if errors.Is(err, remember.ErrNotFound) {
+			continue
+		}
+
+		val, err := remember.DecodeValue(payload)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = val
+	}
+	return result, nil
+}
+
+// SetMany puts several values into the cache. The final parameter, expires, is optional, and applies
+// to every item. Memcached has no multi-key set, so the items are written one at a time.
+func (c *Cache) SetMany(items map[string]any, expires ...time.Duration) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	var expiresAt time.Time
+	if len(expires) > 0 && expires[0] > 0 {
+		expiresAt = time.Now().Add(expires[0])
+	}
+
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	_, sigs, err := c.fetch(keys, false)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range items {
+		data, err := remember.EncodeValue(c.Codec, value)
+		if err != nil {
+			return err
+		}
+
+		err = c.Conn.Set(&memcache.Item{
+			Key:        c.storageKey(key),
+			Value:      itemValue(expiresAt, data),
+			Flags:      sigs[key],
+			Expiration: itemExpiration(expiresAt),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForgetMany removes several items from the cache.
+func (c *Cache) ForgetMany(keys []string) error {
+	for _, key := range keys {
+		if err := c.Forget(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Empty hides every entry in the cache, by starting a new namespace.
+func (c *Cache) Empty() error {
+	if c.closed.Load() {
+		return remember.ErrClosed
+	}
+
+	return c.Conn.Set(&memcache.Item{Key: c.indexKey(), Value: newNamespace().encode()})
+}
+
+// EmptyByMatch hides all entries in the cache which have the prefix match, by moving on match's
+// generation. The entries themselves are left for memcached to evict.
+func (c *Cache) EmptyByMatch(match string) error {
+	if match == "" {
+		return c.Empty()
+	}
+	if c.closed.Load() {
+		return remember.ErrClosed
+	}
+
+	for {
+		item, err := c.Conn.Get(c.indexKey())
+		if errors.Is(err, memcache.ErrCacheMiss) {
+			// A new namespace hides everything, including match.
+			return c.Empty()
+		}
+		if err != nil {
+			return err
+		}
+
+		ns := decodeNamespace(item.Value)
+		ns.empty(match)
+		item.Value = ns.encode()
+
+		err = c.Conn.CompareAndSwap(item)
+		if errors.Is(err, memcache.ErrCASConflict) || errors.Is(err, memcache.ErrNotStored) || errors.Is(err, memcache.ErrCacheMiss) {
+			continue
+		}
+		return err
+	}
+}
+
+// GetCtx attempts to retrieve a value from the cache, returning ctx.Err() if ctx is already done.
+func (c *Cache) GetCtx(ctx context.Context, key string) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.Get(key)
+}
+
+// HasCtx checks for existence of item in cache, returning false if ctx is already done.
+func (c *Cache) HasCtx(ctx context.Context, key string) bool {
+	return ctx.Err() == nil && c.Has(key)
+}
+
+// SetCtx puts a value into the cache, returning ctx.Err() if ctx is already done. The final
+// parameter, expires, is optional.
+func (c *Cache) SetCtx(ctx context.Context, key string, value any, expires ...time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Set(key, value, expires...)
+}
+
+// ForgetCtx removes an item from the cache, by key, returning ctx.Err() if ctx is already done.
+func (c *Cache) ForgetCtx(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Forget(key)
+}
+
+// EmptyByMatchCtx removes all entries in the cache which have the prefix match, returning ctx.Err()
+// if ctx is already done.
+func (c *Cache) EmptyByMatchCtx(ctx context.Context, match string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.EmptyByMatch(match)
+}
+
+// EmptyCtx removes all entries from the cache, returning ctx.Err() if ctx is already done.
+func (c *Cache) EmptyCtx(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Empty()
+}
+
+// Increment atomically adds delta to the int64 counter stored at key, and returns the new value. A
+// missing key is treated as 0. The optional ttl is applied only when the counter is created; an
+// existing counter keeps its expiry. Memcached's own incr cannot go below zero, so the counter is
+// updated with compare-and-swap instead.
+func (c *Cache) Increment(key string, delta int64, ttl ...time.Duration) (int64, error) {
+	for {
+		items, sigs, err := c.fetch([]string{key}, true)
+		if err != nil {
+			return 0, err
+		}
+
+		item := items[c.storageKey(key)]
+		expiresAt, payload, err := c.live(item, sigs[key])
+
+		var n int64
+		switch {
+		case err == nil:
+			if n, err = remember.ParseCounter(key, payload); err != nil {
+				return 0, err
+			}
+
+		case errors.Is(err, remember.ErrNotFound):
+			expiresAt = time.Time{}
+			if t := remember.CounterTTL(ttl); t > 0 {
+				expiresAt = time.Now().Add(t)
+			}
+
+		default:
+			return 0, err
+		}
+
+		n += delta
+		err = c.replace(key, item, sigs[key], expiresAt, remember.FormatCounter(n))
+		if errors.Is(err, errConflict) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		return n, nil
+	}
+}
+
+// Decrement atomically subtracts delta from the counter stored at key, and returns the new value. See
+// Increment.
+func (c *Cache) Decrement(key string, delta int64, ttl ...time.Duration) (int64, error) {
+	return c.Increment(key, -delta, ttl...)
+}
+
+// TTL returns the time remaining before key expires, or remember.NoExpiration if it never expires.
+// Memcached cannot report an item's expiry, so it is read from the copy stored with the value.
+func (c *Cache) TTL(key string) (time.Duration, error) {
+	items, sigs, err := c.fetch([]string{key}, true)
+	if err != nil {
+		return 0, err
+	}
+
+	expiresAt, _, err := c.live(items[c.storageKey(key)], sigs[key])
+	if err != nil {
+		return 0, err
+	}
+	if expiresAt.IsZero() {
+		return remember.NoExpiration, nil
+	}
+	return time.Until(expiresAt), nil
+}
+
+// Touch sets the time remaining before key expires to ttl.
+func (c *Cache) Touch(key string, ttl time.Duration) error {
+	return c.setExpiry(key, time.Now().Add(ttl))
+}
+
+// Persist removes the expiry from key, so that it never expires.
+func (c *Cache) Persist(key string) error {
+	return c.setExpiry(key, time.Time{})
+}
+
+// setExpiry rewrites the value stored at key with a new expiry. The zero time means the value never
+// expires.
+func (c *Cache) setExpiry(key string, expiresAt time.Time) error {
+	for {
+		items, sigs, err := c.fetch([]string{key}, true)
+		if err != nil {
+			return err
+		}
+
+		item := items[c.storageKey(key)]
+		_, payload, err := c.live(item, sigs[key])
+		if err != nil {
+			return err
+		}
+
+		err = c.replace(key, item, sigs[key], expiresAt, payload)
+		if errors.Is(err, errConflict) {
+			continue
+		}
+		return err
+	}
+}
+
+// GetInt is a convenience method which retrieves a value from the cache, converts it to an int, and returns it.
+func (c *Cache) GetInt(key string) (int, error) {
+	return remember.GetInt(c, key)
+}
+
+// GetString is a convenience method which retrieves a value from the cache and returns it as a string.
+func (c *Cache) GetString(key string) (string, error) {
+	return remember.GetAs[string](c, key)
+}
+
+// GetTime retrieves a value from the cache by the specified key and returns it as time.Time.
+func (c *Cache) GetTime(key string) (time.Time, error) {
+	return remember.GetAs[time.Time](c, key)
+}
+
+// errConflict reports that an item changed between being read and being replaced.
+var errConflict = errors.New("memcached item changed concurrently")
+
+// replace writes payload to key, under the generation signature sig. If item, as previously read, is
+// not nil it is replaced with compare-and-swap; otherwise the key is added. Either way,
+// errConflict means another writer got there first.
+func (c *Cache) replace(key string, item *memcache.Item, sig uint32, expiresAt time.Time, payload []byte) error {
+	value := itemValue(expiresAt, payload)
+	expiration := itemExpiration(expiresAt)
+
+	var err error
+	if item == nil {
+		err = c.Conn.Add(&memcache.Item{Key: c.storageKey(key), Value: value, Flags: sig, Expiration: expiration})
+	} else {
+		item.Value, item.Flags, item.Expiration = value, sig, expiration
+		err = c.Conn.CompareAndSwap(item)
+	}
+
+	if errors.Is(err, memcache.ErrNotStored) || errors.Is(err, memcache.ErrCASConflict) || errors.Is(err, memcache.ErrCacheMiss) {
+		return errConflict
+	}
+	return err
+}
+
+// fetch reads the namespace index and, if withValues is true, the items stored at keys, in a single
+// round trip. Items are returned by storage key, and generation signatures by key.
+func (c *Cache) fetch(keys []string, withValues bool) (map[string]*memcache.Item, map[string]uint32, error) {
+	if c.closed.Load() {
+		return nil, nil, remember.ErrClosed
+	}
+
+	wanted := []string{c.indexKey()}
+	if withValues {
+		for _, key := range keys {
+			wanted = append(wanted, c.storageKey(key))
+		}
+	}
+
+	items, err := c.Conn.GetMulti(wanted)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var ns *namespace
+	if index, ok := items[c.indexKey()]; ok {
+		ns = decodeNamespace(index.Value)
+	} else if ns, err = c.startNamespace(); err != nil {
+		return nil, nil, err
+	}
+
+	sigs := make(map[string]uint32, len(keys))
+	for _, key := range keys {
+		sigs[key] = ns.signature(key)
+	}
+	return items, sigs, nil
+}
+
+// startNamespace stores a new namespace index, when there is none, and returns the index in use. An
+// index is created even for reads, so that values written under an index which memcached has since
+// evicted never become visible again.
+func (c *Cache) startNamespace() (*namespace, error) {
+	ns := newNamespace()
+	err := c.Conn.Add(&memcache.Item{Key: c.indexKey(), Value: ns.encode()})
+	if !errors.Is(err, memcache.ErrNotStored) {
+		return ns, err
+	}
+
+	// Another client created the index first.
+	item, err := c.Conn.Get(c.indexKey())
+	if err != nil {
+		return nil, err
+	}
+	return decodeNamespace(item.Value), nil
+}
+
+// live returns the expiry and payload of item, which must have been written under the generation
+// signature sig. Items which are missing, were written under other generations or have expired are
+// reported as remember.ErrNotFound or remember.ErrExpired.
+func (c *Cache) live(item *memcache.Item, sig uint32) (time.Time, []byte, error) {
+	if item == nil || item.Flags != sig || len(item.Value) < headerSize {
+		return time.Time{}, nil, remember.ErrNotFound
+	}
+
+	var expiresAt time.Time
+	if nanos := binary.BigEndian.Uint64(item.Value); nanos != 0 {
+		expiresAt = time.Unix(0, int64(nanos))
+		if !time.Now().Before(expiresAt) {
+			return time.Time{}, nil, remember.ErrExpired
+		}
+	}
+	return expiresAt, item.Value[headerSize:], nil
+}
+
+// storageKey returns the memcached key under which the value for key is stored. The colon is kept
+// even when Prefix is empty, so that no key can be stored at the index key.
+func (c *Cache) storageKey(key string) string {
+	return legalKey(c.Prefix + ":" + key)
+}
+
+// indexKey returns the memcached key holding the namespace index.
+func (c *Cache) indexKey() string {
+	return legalKey(c.Prefix + "#index")
+}
+
+// namespace is the namespace index of a Cache: the generation of the namespace as a
+// whole, and the generations of the prefixes which EmptyByMatch has emptied since it was started.
+type namespace struct {
+	Generation string            `json:"generation"`
+	Matches    map[string]string `json:"matches,omitempty"`
+}
+
+// newNamespace returns a namespace with a new generation and no emptied prefixes.
+func newNamespace() *namespace {
+	return &namespace{Generation: newGeneration(), Matches: make(map[string]string)}
+}
+
+// decodeNamespace parses a stored index. An index which cannot be parsed is treated as a
+// new namespace, which hides every value written under it.
+func decodeNamespace(data []byte) *namespace {
+	ns := &namespace{}
+	if err := json.Unmarshal(data, ns); err != nil || ns.Generation == "" {
+		return newNamespace()
+	}
+	if ns.Matches == nil {
+		ns.Matches = make(map[string]string)
+	}
+	return ns
+}
+
+// empty moves on the generation of match. Prefixes which start with match are forgotten, since the
+// values they cover are hidden by match's new generation anyway. If the index already holds
+// maxMatches prefixes, the namespace is started again instead.
+func (ns *namespace) empty(match string) {
+	for m := range ns.Matches {
+		if strings.HasPrefix(m, match) {
+			delete(ns.Matches, m)
+		}
+	}
+
+	if len(ns.Matches) >= maxMatches {
+		*ns = *newNamespace()
+		return
+	}
+	ns.Matches[match] = newGeneration()
+}
+
+func (ns *namespace) encode() []byte {
+	data, _ := json.Marshal(ns)
+	return data
+}
+
+// signature hashes the generations which apply to key: the namespace's, and those of the emptied
+// prefixes of key, in order.
+func (ns *namespace) signature(key string) uint32 {
+	var matches []string
+	for match := range ns.Matches {
+		if strings.HasPrefix(key, match) {
+			matches = append(matches, match)
+		}
+	}
+	sort.Strings(matches)
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(ns.Generation))
+	for _, match := range matches {
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(match))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(ns.Matches[match]))
+	}
+	return h.Sum32()
+}
+
+// newGeneration returns a new generation.
+func newGeneration() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// memcachedKey returns key if memcached accepts it, and otherwise a hash of it. Memcached rejects keys
+// longer than 250 bytes and keys containing spaces or control characters.
+func legalKey(key string) string {
+	if len(key) <= maxKeyLength {
+		legal := true
+		for i := 0; i < len(key); i++ {
+			if key[i] <= ' ' || key[i] == 0x7f {
+				legal = false
+				break
+			}
+		}
+		if legal {
+			return key
+		}
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	return "#sha256:" + hex.EncodeToString(sum[:])
+}
+
+// memcachedValue puts the expiry, as Unix nanoseconds with zero meaning none, in front of payload.
+func itemValue(expiresAt time.Time, payload []byte) []byte {
+	value := make([]byte, headerSize, headerSize+len(payload))
+	if !expiresAt.IsZero() {
+		binary.BigEndian.PutUint64(value, uint64(expiresAt.UnixNano()))
+	}
+	return append(value, payload...)
+}
+
+// itemExpiration converts an expiry into memcached's form: seconds from now for up to 30 days,
+// and a Unix time beyond that. Memcached only has whole seconds, so the stored expiry is what makes
+// shorter expiries exact.
+func itemExpiration(expiresAt time.Time) int32 {
+	if expiresAt.IsZero() {
+		return 0
+	}
+
+	d := time.Until(expiresAt)
+	switch {
+	case d <= 0:
+		return -1
+	case d <= maxRelativeExpiry:
+		return int32(math.Ceil(d.Seconds()))
+	default:
+		return int32(expiresAt.Unix())
+	}
+}
@@ -0,0 +1,143 @@
+package memcached
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tsawler/remember/v2"
+	"github.com/tsawler/remember/v2/internal/cachetest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestCache returns a Cache backed by a cachetest.Memcached.
+func newTestCache(t *testing.T, prefix string) (*Cache, *cachetest.Memcached) {
+	t.Helper()
+
+	server := cachetest.StartMemcached(t)
+	cache, err := New(WithServers(server.Addr()), remember.WithPrefix(prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = cache.Close() })
+	return cache, server
+}
+
+func TestNew(t *testing.T) {
+	server := cachetest.StartMemcached(t)
+
+	cache, err := remember.New("memcached", &remember.Options{MemcachedServers: []string{server.Addr()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	_, err = remember.New("memcached", &remember.Options{MemcachedServers: []string{"localhost"}})
+	if !errors.Is(err, remember.ErrInvalidOptions) {
+		t.Error("expected ErrInvalidOptions for a server without a port, got", err)
+	}
+}
+
+func TestCache_IndexReads(t *testing.T) {
+	cache, server := newTestCache(t, "test")
+
+	key := strings.Repeat("k", 200)
+	_ = cache.Set(key, "long")
+	_ = cache.EmptyByMatch("other")
+
+	before := server.Reads()
+	if val, _ := cache.GetString(key); val != "long" {
+		t.Error("expected long, got", val)
+	}
+	if n := server.Reads() - before; n != 2 {
+		t.Errorf("expected Get to read the value and the index, got %d keys", n)
+	}
+}
+
+func TestCache_EmptyPrefix(t *testing.T) {
+	cache, _ := newTestCache(t, "")
+
+	_ = cache.Set("#index", "not the index")
+	_ = cache.Set("user:1", "a")
+	_ = cache.EmptyByMatch("user:")
+
+	if val, _ := cache.GetString("#index"); val != "not the index" {
+		t.Error("expected a key named like the index to be kept, got", val)
+	}
+	if cache.Has("user:1") {
+		t.Error("expected EmptyByMatch to hide user:1")
+	}
+}
+
+func TestCache_IndexSize(t *testing.T) {
+	cache, _ := newTestCache(t, "test")
+
+	_ = cache.Set("user:1:name", "a")
+	_ = cache.Set("user:2:name", "b")
+	_ = cache.Set("other", "c")
+	_ = cache.EmptyByMatch("user:1:")
+	_ = cache.EmptyByMatch("user:")
+
+	item, _ := cache.Conn.Get(cache.indexKey())
+	ns := decodeNamespace(item.Value)
+	if len(ns.Matches) != 1 {
+		t.Error("expected emptying user: to forget user:1:, got", ns.Matches)
+	}
+	if cache.Has("user:1:name") || cache.Has("user:2:name") || !cache.Has("other") {
+		t.Error("EmptyByMatch hid the wrong keys")
+	}
+
+	for i := 0; i < maxMatches+10; i++ {
+		if err := cache.EmptyByMatch(fmt.Sprintf("pattern%d:", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	item, _ = cache.Conn.Get(cache.indexKey())
+	ns = decodeNamespace(item.Value)
+	if len(ns.Matches) > maxMatches {
+		t.Errorf("expected at most %d emptied prefixes in the index, got %d", maxMatches, len(ns.Matches))
+	}
+	if cache.Has("other") {
+		t.Error("expected a new namespace, hiding every value, once the index was full")
+	}
+
+	_ = cache.Set("other", "d")
+	if val, _ := cache.GetString("other"); val != "d" {
+		t.Error("expected d, got", val)
+	}
+}
+
+func TestCache_IndexEvicted(t *testing.T) {
+	cache, _ := newTestCache(t, "test")
+
+	_ = cache.Set("foo", "bar")
+	_ = cache.Conn.Delete(cache.indexKey())
+
+	if cache.Has("foo") {
+		t.Error("expected values written under an evicted index to be hidden")
+	}
+	_ = cache.Set("foo", "baz")
+	if val, _ := cache.GetString("foo"); val != "baz" {
+		t.Error("expected baz, got", val)
+	}
+}
+
+func TestItemExpiration(t *testing.T) {
+	tests := []struct {
+		name     string
+		expires  time.Time
+		expected func(int32) bool
+	}{
+		{"none", time.Time{}, func(e int32) bool { return e == 0 }},
+		{"past", time.Now().Add(-time.Second), func(e int32) bool { return e == -1 }},
+		{"sub-second", time.Now().Add(100 * time.Millisecond), func(e int32) bool { return e == 1 }},
+		{"relative", time.Now().Add(time.Hour), func(e int32) bool { return e == 3600 }},
+		{"absolute", time.Now().Add(60 * 24 * time.Hour), func(e int32) bool { return e > int32(time.Now().Unix()) }},
+	}
+
+	for _, tt := range tests {
+		if e := itemExpiration(tt.expires); !tt.expected(e) {
+			t.Errorf("%s: unexpected expiration %d", tt.name, e)
+		}
+	}
+}
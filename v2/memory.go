@@ -0,0 +1,595 @@
+package remember
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Defaults for the memory cache.
+const (
+	defaultMemoryShards   = 16
+	minMemoryShardBytes   = 1 << 20
+	memoryJanitorInterval = time.Minute
+)
+
+// Sizer may be implemented by values stored in a MemoryCache to report their size in bytes, for the
+// purposes of Options.MaxBytes. Other values have their size estimated.
+type Sizer interface {
+	Size() int64
+}
+
+// MemoryCache is an in-process cache. Values are kept as Go objects and never serialized, so anything
+// can be stored without gob.Register, but a value retrieved from the cache is the same object that was
+// stored: mutating it mutates the cached copy. Keys are spread over a number of independently locked
+// shards. When MaxEntries or MaxBytes is set, the limit is divided exactly between the shards, using
+// fewer shards when the limit is small, and each shard evicts entries according to the configured
+// policy once it exceeds its share, so the cache as a whole never holds more than the limit.
+// Options.Prefix is ignored, since no other client can see the cache's keys.
+type MemoryCache struct {
+	shards []*memoryShard
+	sized  bool // Whether values are sized, which is only needed when MaxBytes is set.
+	group  singleflight.Group
+	closed atomic.Bool
+	done   chan struct{}
+}
+
+// memoryShard is one independently locked part of a MemoryCache.
+type memoryShard struct {
+	mu         sync.Mutex
+	items      map[string]*memoryEntry
+	policy     evictionPolicy
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+}
+
+// memoryEntry is a single value held by a MemoryCache.
+type memoryEntry struct {
+	value     any
+	size      int64
+	expiresAt time.Time // The zero time means the entry never expires.
+}
+
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+func init() {
+	_ = Register("memory", func(ops *Options) (CacheInterface, error) {
+		cache, err := newMemoryCache(ops)
+		if err != nil {
+			return nil, err
+		}
+		return cache, nil
+	})
+}
+
+// newMemoryCache returns a MemoryCache configured by ops, and starts a goroutine which periodically
+// removes expired entries until the cache is closed.
+func newMemoryCache(ops *Options) (*MemoryCache, error) {
+	if err := ops.validate("memory"); err != nil {
+		return nil, err
+	}
+
+	shards := memoryShardCount(ops)
+
+	m := &MemoryCache{
+		shards: make([]*memoryShard, shards),
+		sized:  ops.MaxBytes > 0,
+		done:   make(chan struct{}),
+	}
+
+	for i := range m.shards {
+		maxEntries := int(shareOf(int64(ops.MaxEntries), shards, i))
+		policy, err := newEvictionPolicy(ops.Eviction, maxEntries)
+		if err != nil {
+			return nil, err
+		}
+
+		m.shards[i] = &memoryShard{
+			items:      make(map[string]*memoryEntry),
+			policy:     policy,
+			maxEntries: maxEntries,
+			maxBytes:   shareOf(ops.MaxBytes, shards, i),
+		}
+	}
+
+	go m.janitor()
+
+	return m, nil
+}
+
+// memoryShardCount returns the number of shards for a memory cache configured by ops. A small limit
+// is split between fewer shards than configured, so that every shard gets at least one entry and
+// minMemoryShardBytes.
+func memoryShardCount(ops *Options) int {
+	shards := ops.Shards
+	if shards <= 0 {
+		shards = defaultMemoryShards
+	}
+	if ops.MaxEntries > 0 && shards > ops.MaxEntries {
+		shards = ops.MaxEntries
+	}
+	if ops.MaxBytes > 0 && int64(shards) > ops.MaxBytes/minMemoryShardBytes {
+		shards = max(1, int(ops.MaxBytes/minMemoryShardBytes))
+	}
+	return shards
+}
+
+// shareOf returns shard i's share of limit, split exactly between shards, so that the shares add up
+// to limit.
+func shareOf(limit int64, shards, i int) int64 {
+	share := limit / int64(shards)
+	if int64(i) < limit%int64(shards) {
+		share++
+	}
+	return share
+}
+
+// janitor removes expired entries every memoryJanitorInterval, so that keys which are never read again
+// do not occupy memory indefinitely.
+func (m *MemoryCache) janitor() {
+	ticker := time.NewTicker(memoryJanitorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case now := <-ticker.C:
+			for _, s := range m.shards {
+				s.mu.Lock()
+				for key, e := range s.items {
+					if e.expired(now) {
+						s.remove(key)
+					}
+				}
+				s.mu.Unlock()
+			}
+		}
+	}
+}
+
+// shard returns the shard responsible for key.
+func (m *MemoryCache) shard(key string) *memoryShard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return m.shards[h.Sum32()%uint32(len(m.shards))]
+}
+
+// lookup returns the live entry for key. Expired entries are removed and reported as ErrExpired. The
+// shard's lock must be held.
+func (s *memoryShard) lookup(key string) (*memoryEntry, error) {
+	e, ok := s.items[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if e.expired(time.Now()) {
+		s.remove(key)
+		return nil, ErrExpired
+	}
+	return e, nil
+}
+
+// store puts an entry into the shard. Room is made for a new key before it is added, as the policy
+// would otherwise be free to choose the new key itself as the victim. The shard's lock must be held.
+func (s *memoryShard) store(key string, e *memoryEntry) {
+	if old, ok := s.items[key]; ok {
+		s.bytes += e.size - old.size
+		s.items[key] = e
+		s.policy.accessed(key)
+	} else {
+		s.evict(1, e.size)
+		s.items[key] = e
+		s.bytes += e.size
+		s.policy.added(key)
+	}
+
+	s.evict(0, 0)
+}
+
+// evict removes entries chosen by the policy until the shard has room for the given number of
+// additional entries and bytes. The shard's lock must be held.
+func (s *memoryShard) evict(entries int, bytes int64) {
+	for len(s.items) > 0 && s.over(entries, bytes) {
+		victim, ok := s.policy.victim()
+		if !ok {
+			return
+		}
+		if old, ok := s.items[victim]; ok {
+			s.bytes -= old.size
+			delete(s.items, victim)
+		}
+	}
+}
+
+// over reports whether adding the given number of entries and bytes would take the shard over either
+// of its limits. The shard's lock must be held.
+func (s *memoryShard) over(entries int, bytes int64) bool {
+	return (s.maxEntries > 0 && len(s.items)+entries > s.maxEntries) ||
+		(s.maxBytes > 0 && s.bytes+bytes > s.maxBytes)
+}
+
+// remove deletes key from the shard. The shard's lock must be held.
+func (s *memoryShard) remove(key string) {
+	if e, ok := s.items[key]; ok {
+		s.bytes -= e.size
+		delete(s.items, key)
+		s.policy.removed(key)
+	}
+}
+
+// newEntry builds an entry for value which expires after the optional duration. The value is only
+// sized when the cache has a byte limit.
+func (m *MemoryCache) newEntry(value any, expires []time.Duration) *memoryEntry {
+	e := &memoryEntry{value: value}
+	if m.sized {
+		e.size = sizeOf(value)
+	}
+	if len(expires) > 0 && expires[0] > 0 {
+		e.expiresAt = time.Now().Add(expires[0])
+	}
+	return e
+}
+
+// Has checks to see if the supplied key is in the cache and returns true if found, otherwise false.
+func (m *MemoryCache) Has(key string) bool {
+	_, err := m.Get(key)
+	return err == nil
+}
+
+// Close stops the background removal of expired entries and releases the cache's contents. Any later
+// operation returns ErrClosed.
+func (m *MemoryCache) Close() error {
+	if !m.closed.CompareAndSwap(false, true) {
+		return ErrClosed
+	}
+	close(m.done)
+
+	for _, s := range m.shards {
+		s.mu.Lock()
+		s.items = make(map[string]*memoryEntry)
+		s.bytes = 0
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// Get attempts to retrieve a value from the cache.
+func (m *MemoryCache) Get(key string) (any, error) {
+	if m.closed.Load() {
+		return nil, ErrClosed
+	}
+
+	s := m.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, err := s.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	s.policy.accessed(key)
+	return e.value, nil
+}
+
+// Set puts a value into the cache. The final parameter, expires, is optional.
+func (m *MemoryCache) Set(key string, value any, expires ...time.Duration) error {
+	if m.closed.Load() {
+		return ErrClosed
+	}
+
+	e := m.newEntry(value, expires)
+
+	s := m.shard(key)
+	s.mu.Lock()
+	s.store(key, e)
+	s.mu.Unlock()
+	return nil
+}
+
+// Remember returns the value stored at key. If the key is not in the cache, fn is called to compute
+// the value, which is stored with the given ttl (0 means no expiry) and returned. Concurrent misses
+// for the same key share a single call to fn.
+func (m *MemoryCache) Remember(key string, ttl time.Duration, fn func() (any, error)) (any, error) {
+	return Remember(m, &m.group, key, ttl, fn)
+}
+
+// Forget removes an item from the cache, by key.
+func (m *MemoryCache) Forget(key string) error {
+	if m.closed.Load() {
+		return ErrClosed
+	}
+
+	s := m.shard(key)
+	s.mu.Lock()
+	s.remove(key)
+	s.mu.Unlock()
+	return nil
+}
+
+// GetMany retrieves several values from the cache. Keys which are not in the cache are omitted from
+// the returned map.
+func (m *MemoryCache) GetMany(keys []string) (map[string]any, error) {
+	result := make(map[string]any, len(keys))
+	for _, key := range keys {
+		val, err := m.Get(key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result[key] = val
+	}
+	return result, nil
+}
+
+// SetMany puts several values into the cache. The final parameter, expires, is optional, and applies
+// to every item.
+func (m *MemoryCache) SetMany(items map[string]any, expires ...time.Duration) error {
+	for key, value := range items {
+		if err := m.Set(key, value, expires...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForgetMany removes several items from the cache.
+func (m *MemoryCache) ForgetMany(keys []string) error {
+	for _, key := range keys {
+		if err := m.Forget(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EmptyByMatch removes all entries in the cache which have the prefix match.
+func (m *MemoryCache) EmptyByMatch(match string) error {
+	if m.closed.Load() {
+		return ErrClosed
+	}
+
+	for _, s := range m.shards {
+		s.mu.Lock()
+		for key := range s.items {
+			if strings.HasPrefix(key, match) {
+				s.remove(key)
+			}
+		}
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// Empty removes all entries from the cache.
+func (m *MemoryCache) Empty() error {
+	return m.EmptyByMatch("")
+}
+
+// GetCtx attempts to retrieve a value from the cache, returning ctx.Err() if ctx is already done.
+func (m *MemoryCache) GetCtx(ctx context.Context, key string) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.Get(key)
+}
+
+// HasCtx checks for existence of item in cache, returning false if ctx is already done.
+func (m *MemoryCache) HasCtx(ctx context.Context, key string) bool {
+	return ctx.Err() == nil && m.Has(key)
+}
+
+// SetCtx puts a value into the cache, returning ctx.Err() if ctx is already done. The final
+// parameter, expires, is optional.
+func (m *MemoryCache) SetCtx(ctx context.Context, key string, value any, expires ...time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.Set(key, value, expires...)
+}
+
+// ForgetCtx removes an item from the cache, by key, returning ctx.Err() if ctx is already done.
+func (m *MemoryCache) ForgetCtx(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.Forget(key)
+}
+
+// EmptyByMatchCtx removes all entries in the cache which have the prefix match, returning ctx.Err()
+// if ctx is already done.
+func (m *MemoryCache) EmptyByMatchCtx(ctx context.Context, match string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.EmptyByMatch(match)
+}
+
+// EmptyCtx removes all entries from the cache, returning ctx.Err() if ctx is already done.
+func (m *MemoryCache) EmptyCtx(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.Empty()
+}
+
+// Increment atomically adds delta to the int64 counter stored at key, and returns the new value. A
+// missing key is treated as 0. The optional ttl is applied only when the counter is created; an
+// existing counter keeps its expiry.
+func (m *MemoryCache) Increment(key string, delta int64, ttl ...time.Duration) (int64, error) {
+	if m.closed.Load() {
+		return 0, ErrClosed
+	}
+
+	s := m.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, err := s.lookup(key)
+	if errors.Is(err, ErrNotFound) {
+		e = m.newEntry(delta, []time.Duration{CounterTTL(ttl)})
+		s.store(key, e)
+		return delta, nil
+	}
+
+	n, ok := e.value.(int64)
+	if !ok {
+		return 0, fmt.Errorf("%w: key %s", ErrNotInteger, key)
+	}
+	e.value = n + delta
+	s.policy.accessed(key)
+	return n + delta, nil
+}
+
+// Decrement atomically subtracts delta from the counter stored at key, and returns the new value. See
+// Increment.
+func (m *MemoryCache) Decrement(key string, delta int64, ttl ...time.Duration) (int64, error) {
+	return m.Increment(key, -delta, ttl...)
+}
+
+// TTL returns the time remaining before key expires, or NoExpiration if it never expires.
+func (m *MemoryCache) TTL(key string) (time.Duration, error) {
+	if m.closed.Load() {
+		return 0, ErrClosed
+	}
+
+	s := m.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, err := s.lookup(key)
+	if err != nil {
+		return 0, err
+	}
+	if e.expiresAt.IsZero() {
+		return NoExpiration, nil
+	}
+	return time.Until(e.expiresAt), nil
+}
+
+// Touch sets the time remaining before key expires to ttl.
+func (m *MemoryCache) Touch(key string, ttl time.Duration) error {
+	return m.setExpiry(key, time.Now().Add(ttl))
+}
+
+// Persist removes the expiry from key, so that it never expires.
+func (m *MemoryCache) Persist(key string) error {
+	return m.setExpiry(key, time.Time{})
+}
+
+// setExpiry changes the expiry of the entry stored at key.
+func (m *MemoryCache) setExpiry(key string, expiresAt time.Time) error {
+	if m.closed.Load() {
+		return ErrClosed
+	}
+
+	s := m.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, err := s.lookup(key)
+	if err != nil {
+		return err
+	}
+	e.expiresAt = expiresAt
+	return nil
+}
+
+// Len returns the number of entries in the cache, including any which have expired but not yet been
+// removed.
+func (m *MemoryCache) Len() int {
+	n := 0
+	for _, s := range m.shards {
+		s.mu.Lock()
+		n += len(s.items)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// GetInt is a convenience method which retrieves a value from the cache, converts it to an int, and returns it.
+func (m *MemoryCache) GetInt(key string) (int, error) {
+	return GetInt(m, key)
+}
+
+// GetString is a convenience method which retrieves a value from the cache and returns it as a string.
+func (m *MemoryCache) GetString(key string) (string, error) {
+	return GetAs[string](m, key)
+}
+
+// GetTime retrieves a value from the cache by the specified key and returns it as time.Time.
+func (m *MemoryCache) GetTime(key string) (time.Time, error) {
+	return GetAs[time.Time](m, key)
+}
+
+// sizeOf estimates the number of bytes used by v. Values implementing Sizer report their own size;
+// otherwise the estimate follows pointers, slices, maps and struct fields.
+func sizeOf(v any) int64 {
+	if s, ok := v.(Sizer); ok {
+		return s.Size()
+	}
+	return sizeOfValue(reflect.ValueOf(v), 0)
+}
+
+// maxSizeDepth stops sizeOfValue from following cyclic or very deep structures forever.
+const maxSizeDepth = 8
+
+func sizeOfValue(v reflect.Value, depth int) int64 {
+	if !v.IsValid() {
+		return 0
+	}
+	if depth > maxSizeDepth {
+		return int64(v.Type().Size())
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return int64(v.Type().Size()) + int64(v.Len())
+
+	case reflect.Slice, reflect.Array:
+		size := int64(v.Type().Size())
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return size + int64(v.Len())
+		}
+		for i := 0; i < v.Len(); i++ {
+			size += sizeOfValue(v.Index(i), depth+1)
+		}
+		return size
+
+	case reflect.Map:
+		size := int64(v.Type().Size())
+		iter := v.MapRange()
+		for iter.Next() {
+			size += sizeOfValue(iter.Key(), depth+1) + sizeOfValue(iter.Value(), depth+1)
+		}
+		return size
+
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return int64(v.Type().Size())
+		}
+		return int64(v.Type().Size()) + sizeOfValue(v.Elem(), depth+1)
+
+	case reflect.Struct:
+		var size int64
+		for i := 0; i < v.NumField(); i++ {
+			size += sizeOfValue(v.Field(i), depth+1)
+		}
+		return max(size, int64(v.Type().Size()))
+
+	default:
+		return int64(v.Type().Size())
+	}
+}
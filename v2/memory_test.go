@@ -0,0 +1,267 @@
+package remember
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newTestMemoryCache(t *testing.T, ops *Options) *MemoryCache {
+	c, err := New("memory", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c.(*MemoryCache)
+}
+
+func TestMemoryCache(t *testing.T) {
+	c := newTestMemoryCache(t, &Options{})
+
+	type student struct {
+		Name string
+		Age  int
+	}
+	mary := &student{Name: "Mary", Age: 10}
+
+	err := c.Set("mary", mary)
+	if err != nil {
+		t.Error(err)
+	}
+
+	x, err := c.Get("mary")
+	if err != nil {
+		t.Error(err)
+	}
+	if x != mary {
+		t.Error("memory cache should return the stored object itself")
+	}
+
+	s, err := GetAs[*student](c, "mary")
+	if err != nil || s.Name != "Mary" {
+		t.Error("wrong value from GetAs:", s, err)
+	}
+
+	_ = c.Set("expiring", "x", time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	_, err = c.Get("expiring")
+	if !errors.Is(err, ErrExpired) || !errors.Is(err, ErrNotFound) {
+		t.Error("expected ErrExpired, got", err)
+	}
+
+	_ = c.SetMany(map[string]any{"fooa": 1, "foob": 2, "bar": 3})
+	found, _ := c.GetMany([]string{"fooa", "foob", "bar", "missing"})
+	if len(found) != 3 {
+		t.Error("expected 3 values from GetMany, got", found)
+	}
+
+	err = c.EmptyByMatch("foo")
+	if err != nil {
+		t.Error(err)
+	}
+	if c.Has("fooa") || c.Has("foob") || !c.Has("bar") {
+		t.Error("EmptyByMatch removed the wrong keys")
+	}
+
+	n, _ := c.Increment("counter", 3, time.Hour)
+	n, _ = c.Decrement("counter", 1)
+	if n != 2 {
+		t.Errorf("expected counter to be 2, got %d", n)
+	}
+	i, _ := c.GetInt("counter")
+	if i != 2 {
+		t.Errorf("expected GetInt to return 2, got %d", i)
+	}
+	if _, err := c.Increment("mary", 1); !errors.Is(err, ErrNotInteger) {
+		t.Error("expected ErrNotInteger, got", err)
+	}
+
+	ttl, _ := c.TTL("counter")
+	if ttl <= 0 || ttl > time.Hour {
+		t.Error("unexpected ttl for counter:", ttl)
+	}
+	_ = c.Persist("counter")
+	if ttl, _ := c.TTL("counter"); ttl != NoExpiration {
+		t.Error("expected NoExpiration after Persist, got", ttl)
+	}
+	_ = c.Touch("counter", time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	if c.Has("counter") {
+		t.Error("counter should have expired after Touch")
+	}
+
+	err = c.Empty()
+	if err != nil {
+		t.Error(err)
+	}
+	if c.Len() != 0 {
+		t.Errorf("expected empty cache, has %d entries", c.Len())
+	}
+
+	_ = c.Close()
+	if _, err := c.Get("bar"); !errors.Is(err, ErrClosed) {
+		t.Error("expected ErrClosed, got", err)
+	}
+}
+
+func TestMemoryCache_Eviction(t *testing.T) {
+	var tests = []struct {
+		name     string
+		eviction string
+		evicted  string
+	}{
+		{name: "lru", eviction: EvictLRU, evicted: "b"},
+		{name: "lfu", eviction: EvictLFU, evicted: "c"},
+		{name: "arc", eviction: EvictARC, evicted: "b"},
+	}
+
+	for _, tt := range tests {
+		c := newTestMemoryCache(t, &Options{MaxEntries: 3, Shards: 1, Eviction: tt.eviction})
+
+		_ = c.Set("a", 1)
+		_ = c.Set("b", 2)
+		_ = c.Set("c", 3)
+
+		// a and b are used most often, and c most recently.
+		_, _ = c.Get("a")
+		_, _ = c.Get("b")
+		_, _ = c.Get("b")
+		_, _ = c.Get("a")
+		_, _ = c.Get("c")
+
+		_ = c.Set("d", 4)
+
+		if c.Len() != 3 {
+			t.Errorf("%s: expected 3 entries, got %d", tt.name, c.Len())
+		}
+		if c.Has(tt.evicted) {
+			t.Errorf("%s: expected %s to be evicted", tt.name, tt.evicted)
+		}
+		if !c.Has("a") || !c.Has("d") {
+			t.Errorf("%s: evicted the wrong entry", tt.name)
+		}
+	}
+}
+
+func TestMemoryCache_MaxBytes(t *testing.T) {
+	c := newTestMemoryCache(t, &Options{MaxBytes: 1000, Shards: 1})
+
+	for i := 0; i < 10; i++ {
+		_ = c.Set(fmt.Sprintf("key%d", i), make([]byte, 200))
+	}
+
+	if c.Len() > 5 {
+		t.Errorf("expected at most 5 entries of 200 bytes in 1000 bytes, got %d", c.Len())
+	}
+	if !c.Has("key9") {
+		t.Error("most recently added entry should not have been evicted")
+	}
+}
+
+// countedValue counts the calls to its Size method.
+type countedValue struct{ calls *int }
+
+func (v countedValue) Size() int64 {
+	*v.calls++
+	return 100
+}
+
+func TestMemoryCache_SizedOnlyWithMaxBytes(t *testing.T) {
+	calls := 0
+	c := newTestMemoryCache(t, &Options{})
+	_ = c.Set("unlimited", countedValue{&calls})
+	if calls != 0 {
+		t.Errorf("expected values not to be sized without MaxBytes, got %d calls to Size", calls)
+	}
+
+	c = newTestMemoryCache(t, &Options{MaxBytes: 1000})
+	_ = c.Set("limited", countedValue{&calls})
+	if calls != 1 {
+		t.Errorf("expected the value to be sized once with MaxBytes, got %d calls to Size", calls)
+	}
+}
+
+func TestMemoryCache_LimitsWithDefaultShards(t *testing.T) {
+	var tests = []struct {
+		name    string
+		ops     *Options
+		maxLen  int
+		numKeys int
+	}{
+		{"few entries", &Options{MaxEntries: 3}, 3, 100},
+		{"entries", &Options{MaxEntries: 100}, 100, 1000},
+		{"bytes", &Options{MaxBytes: 1000}, 5, 100},
+	}
+
+	for _, tt := range tests {
+		c := newTestMemoryCache(t, tt.ops)
+		for i := 0; i < tt.numKeys; i++ {
+			_ = c.Set(fmt.Sprintf("key%d", i), make([]byte, 200))
+		}
+
+		if c.Len() > tt.maxLen {
+			t.Errorf("%s: expected at most %d entries, got %d", tt.name, tt.maxLen, c.Len())
+		}
+		if c.Len() == 0 {
+			t.Errorf("%s: expected some entries to be kept", tt.name)
+		}
+	}
+}
+
+func TestMemoryCache_ARCGhosts(t *testing.T) {
+	p := newARCPolicy(2)
+	p.added("a")
+	p.added("b")
+	victim, _ := p.victim()
+	if victim != "a" {
+		t.Errorf("expected a to be evicted first, got %s", victim)
+	}
+
+	// Re-adding a key recently evicted from t1 should favour recency, and promote it to t2.
+	p.added("a")
+	if p.p == 0 {
+		t.Error("expected target size of t1 to grow after a ghost hit")
+	}
+	if p.keys["a"].Value.(*arcItem).list != p.t2 {
+		t.Error("expected ghost hit to be placed in t2")
+	}
+}
+
+func TestNew_MemoryBadEviction(t *testing.T) {
+	_, err := New("memory", &Options{Eviction: "fifo"})
+	if err == nil {
+		t.Error("expected error for unsupported eviction policy")
+	}
+}
+
+type sized struct{}
+
+func (sized) Size() int64 {
+	return 12345
+}
+
+func TestSizeOf(t *testing.T) {
+	var tests = []struct {
+		name     string
+		value    any
+		atLeast  int64
+		expected int64
+	}{
+		{name: "bytes", value: make([]byte, 100), atLeast: 100},
+		{name: "string", value: "hello", atLeast: 5},
+		{name: "map", value: map[string]string{"a": "bb"}, atLeast: 3},
+		{name: "sizer", value: sized{}, expected: 12345},
+		{name: "nil", value: nil, expected: 0},
+	}
+
+	for _, tt := range tests {
+		size := sizeOf(tt.value)
+		if tt.expected != 0 && size != tt.expected {
+			t.Errorf("%s: expected size %d, got %d", tt.name, tt.expected, size)
+		}
+		if size < tt.atLeast {
+			t.Errorf("%s: expected size of at least %d, got %d", tt.name, tt.atLeast, size)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package remember
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// ErrInvalidOptions is wrapped by every error reporting a misconfiguration, so that callers can use
+// errors.Is to tell configuration mistakes apart from connection failures.
+var ErrInvalidOptions = errors.New("invalid options")
+
+// Option configures a cache created by NewRedis, NewBadger, NewBuntDB or NewMemory.
+type Option func(*Options)
+
+// NewRedis returns a Redis cache configured by opts. Anything not set by opts takes the same default as
+// New("redis"): localhost:6379, database 0 and the prefix "dev".
+func NewRedis(opts ...Option) (*RedisCache, error) {
+	return newRedis(buildOptions("redis", opts))
+}
+
+// NewBadger returns a Badger cache configured by opts. The database is stored in ./badger unless
+// WithBadgerPath is given.
+func NewBadger(opts ...Option) (*BadgerCache, error) {
+	return newBadger(buildOptions("badger", opts))
+}
+
+// NewBuntDB returns a BuntDB cache configured by opts. The database is kept in memory unless
+// WithBuntDBPath is given.
+func NewBuntDB(opts ...Option) (*BuntDBCache, error) {
+	return newBuntDB(buildOptions("buntdb", opts))
+}
+
+// NewFile returns a file cache configured by opts. Files are kept below ./cache unless WithFilePath is
+// given.
+func NewFile(opts ...Option) (*FileCache, error) {
+	return newFile(buildOptions("file", opts))
+}
+
+// NewMemory returns an in-process memory cache configured by opts.
+func NewMemory(opts ...Option) (*MemoryCache, error) {
+	return newMemoryCache(buildOptions("memory", opts))
+}
+
+// WithAddr sets the host:port of a single Redis server.
+func WithAddr(addr string) Option {
+	return func(o *Options) { o.Addrs = []string{addr} }
+}
+
+// WithAddrs sets several Redis addresses. More than one address means cluster mode.
+func WithAddrs(addrs ...string) Option {
+	return func(o *Options) { o.Addrs = addrs }
+}
+
+// WithCluster uses Redis Cluster, with addrs as the seed nodes.
+func WithCluster(addrs ...string) Option {
+	return func(o *Options) {
+		o.Addrs = addrs
+		o.Cluster = true
+	}
+}
+
+// WithSentinel uses the Redis master named masterName, found through the Sentinels at addrs.
+func WithSentinel(masterName string, addrs ...string) Option {
+	return func(o *Options) {
+		o.MasterName = masterName
+		o.Addrs = addrs
+	}
+}
+
+// WithURL configures Redis from a redis:// or rediss:// URL.
+func WithURL(url string) Option {
+	return func(o *Options) { o.URL = url }
+}
+
+// WithUsername sets the Redis ACL username.
+func WithUsername(username string) Option {
+	return func(o *Options) { o.Username = username }
+}
+
+// WithPassword sets the Redis password.
+func WithPassword(password string) Option {
+	return func(o *Options) { o.Password = password }
+}
+
+// WithDB selects the Redis database.
+func WithDB(db int) Option {
+	return func(o *Options) { o.DB = db }
+}
+
+// WithTLS connects to Redis over TLS. If caFile is not empty, the certificates in it are trusted
+// instead of the system roots.
+func WithTLS(caFile string) Option {
+	return func(o *Options) {
+		o.TLS = true
+		o.TLSCAFile = caFile
+	}
+}
+
+// WithClientCertificate presents the certificate in certFile, with the key in keyFile, to Redis.
+func WithClientCertificate(certFile, keyFile string) Option {
+	return func(o *Options) {
+		o.TLSCertFile = certFile
+		o.TLSKeyFile = keyFile
+	}
+}
+
+// WithInsecureSkipVerify connects to Redis over TLS without verifying its certificate.
+func WithInsecureSkipVerify() Option {
+	return func(o *Options) { o.TLSSkipVerify = true }
+}
+
+// WithPool sets the maximum and minimum idle number of Redis connections per node.
+func WithPool(size, minIdle int) Option {
+	return func(o *Options) {
+		o.PoolSize = size
+		o.MinIdleConns = minIdle
+	}
+}
+
+// WithTimeouts sets the Redis dial, read and write timeouts. Zero leaves a timeout at its default.
+func WithTimeouts(dial, read, write time.Duration) Option {
+	return func(o *Options) {
+		o.DialTimeout = dial
+		o.ReadTimeout = read
+		o.WriteTimeout = write
+	}
+}
+
+// WithScanBatchSize sets the COUNT hint Redis uses when emptying the cache.
+func WithScanBatchSize(n int) Option {
+	return func(o *Options) { o.ScanBatchSize = n }
+}
+
+// WithInvalidation publishes Redis changes so that other processes can evict local copies.
+func WithInvalidation() Option {
+	return func(o *Options) { o.Invalidation = true }
+}
+
+// WithPrefix sets the prefix for all keys.
+func WithPrefix(prefix string) Option {
+	return func(o *Options) { o.Prefix = prefix }
+}
+
+// WithCodec sets the codec used to serialize values.
+func WithCodec(codec Codec) Option {
+	return func(o *Options) { o.Codec = codec }
+}
+
+// WithBadgerPath sets the directory of the Badger database.
+func WithBadgerPath(path string) Option {
+	return func(o *Options) { o.BadgerPath = path }
+}
+
+// WithBuntDBPath sets the BuntDB database file. Use ":memory:" to keep it in memory.
+func WithBuntDBPath(path string) Option {
+	return func(o *Options) { o.BuntDBPath = path }
+}
+
+// WithFilePath sets the root directory of a file cache.
+func WithFilePath(path string) Option {
+	return func(o *Options) { o.FilePath = path }
+}
+
+// WithMaxEntries limits the number of entries in a memory cache.
+func WithMaxEntries(n int) Option {
+	return func(o *Options) { o.MaxEntries = n }
+}
+
+// WithMaxBytes limits the approximate size of a memory cache's values.
+func WithMaxBytes(n int64) Option {
+	return func(o *Options) { o.MaxBytes = n }
+}
+
+// WithEviction sets a memory cache's eviction policy: EvictLRU, EvictLFU or EvictARC.
+func WithEviction(policy string) Option {
+	return func(o *Options) { o.Eviction = policy }
+}
+
+// WithShards sets the number of independently locked shards in a memory cache.
+func WithShards(n int) Option {
+	return func(o *Options) { o.Shards = n }
+}
+
+// buildOptions applies opts to the defaults for cacheType.
+func buildOptions(cacheType string, opts []Option) *Options {
+	ops := defaultOptions(cacheType)
+	for _, opt := range opts {
+		opt(ops)
+	}
+	return ops
+}
+
+// defaultOptions returns the options New uses for cacheType when none are supplied.
+func defaultOptions(cacheType string) *Options {
+	switch cacheType {
+	case "redis":
+		return &Options{
+			Server:   "localhost",
+			Port:     "6379",
+			Password: "",
+			Prefix:   "dev",
+			DB:       0,
+		}
+
+	case "badger":
+		return &Options{
+			BadgerPath: "./badger",
+		}
+
+	case "buntdb":
+		return &Options{
+			BuntDBPath: ":memory:",
+		}
+
+	case "file":
+		return &Options{
+			FilePath: "./cache",
+		}
+
+	default:
+		return &Options{}
+	}
+}
+
+// withDefaults returns a copy of o with a missing Redis address or database path taken from the
+// defaults for cacheType. The prefix is left alone, since an empty prefix is meaningful.
+func (o *Options) withDefaults(cacheType string) *Options {
+	ops := *o
+	def := defaultOptions(cacheType)
+
+	switch cacheType {
+	case "redis":
+		if ops.URL == "" && len(ops.Addrs) == 0 {
+			if ops.Server == "" {
+				ops.Server = def.Server
+			}
+			if ops.Port == "" {
+				ops.Port = def.Port
+			}
+		}
+
+	case "badger":
+		if ops.BadgerPath == "" {
+			ops.BadgerPath = def.BadgerPath
+		}
+
+	case "buntdb":
+		if ops.BuntDBPath == "" {
+			ops.BuntDBPath = def.BuntDBPath
+		}
+
+	case "file":
+		if ops.FilePath == "" {
+			ops.FilePath = def.FilePath
+		}
+
+	}
+
+	return &ops
+}
+
+// validate reports every problem with o as a cache of type cacheType. Each problem wraps
+// ErrInvalidOptions.
+func (o *Options) validate(cacheType string) error {
+	var problems []string
+
+	switch cacheType {
+	case "redis":
+		problems = o.redisProblems()
+
+	case "badger":
+		if o.BadgerPath == "" {
+			problems = append(problems, "badger requires BadgerPath")
+		}
+
+	case "buntdb":
+		if o.BuntDBPath == "" {
+			problems = append(problems, `buntdb requires BuntDBPath; use ":memory:" for an in-memory database`)
+		}
+
+	case "file":
+		if o.FilePath == "" {
+			problems = append(problems, "file requires FilePath")
+		}
+
+	case "memory":
+		if o.MaxEntries < 0 {
+			problems = append(problems, "MaxEntries must not be negative")
+		}
+		if o.MaxBytes < 0 {
+			problems = append(problems, "MaxBytes must not be negative")
+		}
+		if o.Shards < 0 {
+			problems = append(problems, "Shards must not be negative")
+		}
+		switch o.Eviction {
+		case "", EvictLRU, EvictLFU, EvictARC:
+		default:
+			problems = append(problems, fmt.Sprintf("Eviction %q is not one of %q, %q or %q", o.Eviction, EvictLRU, EvictLFU, EvictARC))
+		}
+	}
+
+	errs := make([]error, len(problems))
+	for i, problem := range problems {
+		errs[i] = fmt.Errorf("%w: %s", ErrInvalidOptions, problem)
+	}
+	return errors.Join(errs...)
+}
+
+// redisProblems describes everything wrong with o as the configuration of a Redis cache.
+func (o *Options) redisProblems() []string {
+	var problems []string
+
+	switch {
+	case o.URL != "" && len(o.Addrs) > 0:
+		problems = append(problems, "set either URL or Addrs, not both")
+
+	case o.URL == "" && len(o.Addrs) == 0:
+		if o.Server == "" {
+			problems = append(problems, "redis requires Server, Addrs or URL")
+		}
+		if port, err := strconv.Atoi(o.Port); err != nil || port < 1 || port > 65535 {
+			problems = append(problems, fmt.Sprintf("Port %q is not a valid port number", o.Port))
+		}
+	}
+
+	for _, addr := range o.Addrs {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			problems = append(problems, fmt.Sprintf("address %q is not of the form host:port", addr))
+		}
+	}
+
+	cluster := o.Cluster || (len(o.Addrs) > 1 && o.MasterName == "")
+	if o.Cluster && o.MasterName != "" {
+		problems = append(problems, "set either Cluster or MasterName, not both")
+	}
+	if o.MasterName != "" && len(o.Addrs) == 0 {
+		problems = append(problems, "MasterName requires the Sentinel addresses in Addrs")
+	}
+	if o.DB < 0 {
+		problems = append(problems, "DB must not be negative")
+	}
+	if cluster && o.DB != 0 {
+		problems = append(problems, "Redis Cluster only supports DB 0")
+	}
+	if o.ScanBatchSize < 0 {
+		problems = append(problems, "ScanBatchSize must not be negative")
+	}
+	if o.PoolSize < 0 || o.MinIdleConns < 0 {
+		problems = append(problems, "PoolSize and MinIdleConns must not be negative")
+	}
+	if (o.TLSCertFile == "") != (o.TLSKeyFile == "") {
+		problems = append(problems, "TLSCertFile and TLSKeyFile must be set together")
+	}
+
+	return problems
+}
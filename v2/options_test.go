@@ -0,0 +1,131 @@
+package remember
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewRedis(t *testing.T) {
+	cache, err := NewRedis(WithAddr(testRedis.Addr()), WithPrefix("functional"), WithCodec(JSONCodec{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	err = cache.Set("foo", "bar")
+	if err != nil {
+		t.Error(err)
+	}
+	if !testRedis.Exists("functional:foo") {
+		t.Error("expected key to be stored with the configured prefix")
+	}
+	if _, ok := cache.Codec.(JSONCodec); !ok {
+		t.Error("expected JSON codec")
+	}
+}
+
+func TestNewRedis_Defaults(t *testing.T) {
+	cache, err := NewRedis(WithTimeouts(time.Second, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	if cache.Prefix != "dev" {
+		t.Error("expected default prefix dev, got", cache.Prefix)
+	}
+}
+
+func TestNewBadger(t *testing.T) {
+	cache, err := NewBadger(WithBadgerPath("./testdata/badger_functional"), WithPrefix("functional"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	err = cache.Set("foo", "bar")
+	if err != nil {
+		t.Error(err)
+	}
+	if !cache.Has("foo") {
+		t.Error("expected foo in cache")
+	}
+}
+
+func TestNewBuntDB(t *testing.T) {
+	cache, err := NewBuntDB(WithPrefix("functional"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	if cache.Prefix != "functional" {
+		t.Error("expected prefix functional, got", cache.Prefix)
+	}
+}
+
+func TestNewMemory(t *testing.T) {
+	cache, err := NewMemory(WithMaxEntries(2), WithEviction(EvictLFU), WithShards(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	for _, key := range []string{"a", "b", "c"} {
+		_ = cache.Set(key, key)
+	}
+	if cache.Len() != 2 {
+		t.Error("expected 2 entries, got", cache.Len())
+	}
+}
+
+func TestNew_FillsDefaults(t *testing.T) {
+	cache, err := New("buntdb", &Options{Prefix: "defaults"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = cache.Close()
+
+	ops := &Options{Prefix: "defaults"}
+	filled := ops.withDefaults("redis")
+	if filled.Server != "localhost" || filled.Port != "6379" || filled.Prefix != "defaults" {
+		t.Error("unexpected redis defaults:", filled.Server, filled.Port, filled.Prefix)
+	}
+	if ops.Server != "" {
+		t.Error("withDefaults modified the caller's options")
+	}
+}
+
+func TestOptionValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		create func() error
+		expect string
+	}{
+		{"empty badger path", func() error { _, err := NewBadger(WithBadgerPath("")); return err }, "BadgerPath"},
+		{"empty buntdb path", func() error { _, err := NewBuntDB(WithBuntDBPath("")); return err }, "BuntDBPath"},
+		{"bad port", func() error { _, err := New("redis", &Options{Server: "localhost", Port: "redis"}); return err }, "valid port"},
+		{"bad address", func() error { _, err := NewRedis(WithAddr("localhost")); return err }, "host:port"},
+		{"url and addrs", func() error { _, err := NewRedis(WithURL("redis://localhost"), WithAddr("localhost:6379")); return err }, "URL or Addrs"},
+		{"cluster db", func() error { _, err := NewRedis(WithCluster("a:1", "b:2"), WithDB(2)); return err }, "DB 0"},
+		{"sentinel without addrs", func() error { _, err := New("redis", &Options{MasterName: "mymaster"}); return err }, "Sentinel"},
+		{"negative db", func() error { _, err := NewRedis(WithDB(-1)); return err }, "DB must not be negative"},
+		{"negative pool", func() error { _, err := NewRedis(WithPool(-1, 0)); return err }, "PoolSize"},
+		{"key without cert", func() error { _, err := NewRedis(WithClientCertificate("", "key.pem")); return err }, "TLSKeyFile"},
+		{"unknown eviction", func() error { _, err := NewMemory(WithEviction("fifo")); return err }, "fifo"},
+		{"negative max entries", func() error { _, err := New("memory", &Options{MaxEntries: -1}); return err }, "MaxEntries"},
+	}
+
+	for _, tt := range tests {
+		err := tt.create()
+		if !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("%s: expected ErrInvalidOptions, got %v", tt.name, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expect) {
+			t.Errorf("%s: expected error to mention %q, got %q", tt.name, tt.expect, err)
+		}
+	}
+}
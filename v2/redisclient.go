@@ -0,0 +1,115 @@
+package remember
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"os"
+)
+
+// newRedisClient returns a single node, Sentinel or cluster client, as described by ops.
+func newRedisClient(ops *Options) (redis.UniversalClient, error) {
+	uo := &redis.UniversalOptions{
+		Addrs:        ops.Addrs,
+		Username:     ops.Username,
+		Password:     ops.Password,
+		DB:           ops.DB,
+		MasterName:   ops.MasterName,
+		PoolSize:     ops.PoolSize,
+		MinIdleConns: ops.MinIdleConns,
+		DialTimeout:  ops.DialTimeout,
+		ReadTimeout:  ops.ReadTimeout,
+		WriteTimeout: ops.WriteTimeout,
+	}
+
+	if ops.URL != "" {
+		u, err := redis.ParseURL(ops.URL)
+		if err != nil {
+			return nil, err
+		}
+		applyURLOptions(uo, u)
+	}
+
+	if len(uo.Addrs) == 0 {
+		uo.Addrs = []string{fmt.Sprintf("%s:%s", ops.Server, ops.Port)}
+	}
+
+	tlsConfig, err := redisTLSConfig(ops, uo.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+	uo.TLSConfig = tlsConfig
+
+	if ops.Cluster && ops.MasterName == "" {
+		return redis.NewClusterClient(uo.Cluster()), nil
+	}
+	return redis.NewUniversalClient(uo), nil
+}
+
+// applyURLOptions copies the settings parsed from a redis:// or rediss:// URL into uo. Pool sizes and
+// timeouts given in the URL's query are only used where uo does not already set them.
+func applyURLOptions(uo *redis.UniversalOptions, u *redis.Options) {
+	uo.Addrs = []string{u.Addr}
+	uo.Username = u.Username
+	uo.Password = u.Password
+	uo.DB = u.DB
+	uo.TLSConfig = u.TLSConfig
+
+	if uo.PoolSize == 0 {
+		uo.PoolSize = u.PoolSize
+	}
+	if uo.MinIdleConns == 0 {
+		uo.MinIdleConns = u.MinIdleConns
+	}
+	if uo.DialTimeout == 0 {
+		uo.DialTimeout = u.DialTimeout
+	}
+	if uo.ReadTimeout == 0 {
+		uo.ReadTimeout = u.ReadTimeout
+	}
+	if uo.WriteTimeout == 0 {
+		uo.WriteTimeout = u.WriteTimeout
+	}
+}
+
+// redisTLSConfig builds the TLS configuration described by ops, starting from base, which may be nil.
+// It returns nil if TLS is not wanted.
+func redisTLSConfig(ops *Options, base *tls.Config) (*tls.Config, error) {
+	wanted := ops.TLS || ops.TLSCAFile != "" || ops.TLSCertFile != "" || ops.TLSKeyFile != "" || ops.TLSSkipVerify
+	if !wanted {
+		return base, nil
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if base != nil {
+		cfg = base.Clone()
+	}
+	cfg.InsecureSkipVerify = cfg.InsecureSkipVerify || ops.TLSSkipVerify
+
+	if ops.TLSCAFile != "" {
+		pem, err := os.ReadFile(ops.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in TLS CA file")
+		}
+		cfg.RootCAs = pool
+	}
+
+	if ops.TLSCertFile != "" || ops.TLSKeyFile != "" {
+		if ops.TLSCertFile == "" || ops.TLSKeyFile == "" {
+			return nil, errors.New("both a TLS certificate and key file are required")
+		}
+		cert, err := tls.LoadX509KeyPair(ops.TLSCertFile, ops.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,66 @@
+package remember
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Factory creates a cache from options. New passes the options it was given, or the defaults for the
+// built-in type when there were none, so a factory for another backend should apply its own defaults
+// to any fields it needs.
+type Factory func(*Options) (CacheInterface, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a cache type available to New under name. It is typically called from an init
+// function in the package providing the backend. Registering a name twice is an error.
+func Register(name string, factory Factory) error {
+	if name == "" || factory == nil {
+		return errors.New("a cache type needs a name and a factory")
+	}
+
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if _, ok := factories[name]; ok {
+		return fmt.Errorf("cache type %q is already registered", name)
+	}
+	factories[name] = factory
+	return nil
+}
+
+// unregister removes the cache type registered under name, so that tests can clean up after
+// themselves.
+func unregister(name string) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	delete(factories, name)
+}
+
+// Backends returns the names of the registered cache types, sorted.
+func Backends() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupFactory returns the factory registered under name.
+func lookupFactory(name string) (Factory, bool) {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	f, ok := factories[name]
+	return f, ok
+}
@@ -0,0 +1,75 @@
+package remember
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	var received *Options
+	err := Register("test_backend", func(ops *Options) (CacheInterface, error) {
+		received = ops
+		return NewMemory()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { unregister("test_backend") })
+
+	cache, err := New("test_backend", &Options{Prefix: "custom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	if received == nil || received.Prefix != "custom" {
+		t.Error("expected factory to receive the options passed to New")
+	}
+	if _, ok := cache.(*MemoryCache); !ok {
+		t.Errorf("expected the cache returned by the factory, got %T", cache)
+	}
+
+	found := false
+	for _, name := range Backends() {
+		if name == "test_backend" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("expected test_backend in Backends()")
+	}
+}
+
+func TestRegister_Errors(t *testing.T) {
+	factory := func(*Options) (CacheInterface, error) { return nil, errors.New("unused") }
+
+	tests := []struct {
+		name    string
+		backend string
+		factory Factory
+	}{
+		{"built-in name", "redis", factory},
+		{"empty name", "", factory},
+		{"nil factory", "test_nil", nil},
+	}
+
+	for _, tt := range tests {
+		err := Register(tt.backend, tt.factory)
+		if err == nil {
+			t.Errorf("%s: expected error but did not get one", tt.name)
+		}
+	}
+}
+
+func TestNew_Builtins(t *testing.T) {
+	for _, name := range []string{"badger", "buntdb", "memory", "redis"} {
+		if _, ok := lookupFactory(name); !ok {
+			t.Errorf("expected %s to be registered", name)
+		}
+	}
+
+	_, err := New("no_such_backend")
+	if err == nil {
+		t.Error("expected error for unregistered cache type")
+	}
+}
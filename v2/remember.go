@@ -1,4 +1,4 @@
-// Package remember provides an easy way to implement a Redis, BuntDB or Badger cache in your Go application.
+// Package remember provides an easy way to implement a Redis, BuntDB, Badger or in-memory cache in your Go application.
 
 package remember
 
@@ -10,185 +10,268 @@ import (
 	"fmt"
 	"github.com/dgraph-io/badger/v3"
 	"github.com/redis/go-redis/v9"
-	"github.com/tidwall/buntdb"
-	"github.com/tsawler/toolbox"
+	"golang.org/x/sync/singleflight"
+	"strconv"
+	"sync"
 	"time"
 )
 
 // CacheInterface is the interface which anything providing cache functionality must satisfy.
 type CacheInterface interface {
 	Empty() error
+	Decrement(key string, delta int64, ttl ...time.Duration) (int64, error)
 	EmptyByMatch(match string) error
 	Forget(key string) error
+	ForgetMany(keys []string) error
 	Get(key string) (any, error)
+	GetMany(keys []string) (map[string]any, error)
 	GetInt(key string) (int, error)
 	GetString(key string) (string, error)
 	GetTime(key string) (time.Time, error)
 	Has(key string) bool
+	Increment(key string, delta int64, ttl ...time.Duration) (int64, error)
+	Persist(key string) error
+	Remember(key string, ttl time.Duration, fn func() (any, error)) (any, error)
 	Set(key string, data any, expires ...time.Duration) error
+	SetMany(items map[string]any, expires ...time.Duration) error
+	Touch(key string, ttl time.Duration) error
+	TTL(key string) (time.Duration, error)
 	Close() error
 }
 
-// RedisCache is the type for a Redis-based cache.
+// NoExpiration is returned by TTL for keys which never expire.
+const NoExpiration time.Duration = -1
+
+// ContextCacheInterface is satisfied by caches whose operations accept a context.Context, so
+// that deadlines, cancellation and tracing spans can be propagated to the underlying store.
+type ContextCacheInterface interface {
+	CacheInterface
+	EmptyCtx(ctx context.Context) error
+	EmptyByMatchCtx(ctx context.Context, match string) error
+	ForgetCtx(ctx context.Context, key string) error
+	GetCtx(ctx context.Context, key string) (any, error)
+	HasCtx(ctx context.Context, key string) bool
+	SetCtx(ctx context.Context, key string, data any, expires ...time.Duration) error
+}
+
+// RedisCache is the type for a Redis-based cache. Conn may be a single node, Sentinel-managed or
+// cluster client.
 type RedisCache struct {
-	Conn         *redis.Client
-	BadgerClient *badger.DB
-	Prefix       string
+	Conn          redis.UniversalClient
+	BadgerClient  *badger.DB
+	Prefix        string
+	Codec         Codec             // The codec used to serialize values. Defaults to GobCodec.
+	ScanBatchSize int               // The COUNT hint passed to SCAN by Empty and EmptyByMatch. Defaults to 1000.
+	OnProgress    func(deleted int) // If set, called by Empty and EmptyByMatch after each batch with the running total.
+	Invalidation  bool              // If true, changes are published on InvalidationChannel for other processes.
+	KeepOpen      bool              // If true, Close leaves Conn open, for clients owned by the caller.
+	group         singleflight.Group
+	originOnce    sync.Once
+	originID      string
 }
 
+// defaultScanBatchSize is used when RedisCache.ScanBatchSize is not set.
+const defaultScanBatchSize = 1000
+
 // Options is the type used to configure a CacheInterface object.
 type Options struct {
-	Server     string // The server where Redis exists.
-	Port       string // The port Redis is listening on.
-	Password   string // The password for Redis.
-	Prefix     string // A prefix to use for all keys for this client.
-	DB         int    // Database. Specifying 0 (the default) means use the default database.
-	BadgerPath string // The location for the badger database on disk.
-	BuntDBPath string // The location for the BuntDB database on disk.
+	Server           string        // The server where Redis exists.
+	Port             string        // The port Redis is listening on.
+	Addrs            []string      // Redis addresses (host:port). If set, used instead of Server and Port. More than one means cluster mode.
+	MasterName       string        // The Sentinel master name. If set, Addrs lists the Sentinels.
+	Cluster          bool          // Use cluster mode, even when Addrs holds a single seed address.
+	URL              string        // A redis:// or rediss:// URL. If set, used instead of Server, Port, Username, Password and DB.
+	Username         string        // The ACL username for Redis.
+	Password         string        // The password for Redis.
+	TLS              bool          // Connect to Redis over TLS. Implied by any of the other TLS options.
+	TLSCAFile        string        // A PEM file of CA certificates used to verify Redis, instead of the system roots.
+	TLSCertFile      string        // A PEM client certificate, for mutual TLS.
+	TLSKeyFile       string        // The PEM private key for TLSCertFile.
+	TLSSkipVerify    bool          // Do not verify Redis's certificate. Only for development.
+	PoolSize         int           // The maximum number of Redis connections per node. Defaults to 10 per CPU.
+	MinIdleConns     int           // The minimum number of idle Redis connections kept open.
+	DialTimeout      time.Duration // The timeout for connecting to Redis. Defaults to 5 seconds.
+	ReadTimeout      time.Duration // The timeout for reading from Redis. Defaults to 3 seconds.
+	WriteTimeout     time.Duration // The timeout for writing to Redis. Defaults to ReadTimeout.
+	Prefix           string        // A prefix to use for all keys for this client.
+	DB               int           // Database. Specifying 0 (the default) means use the default database.
+	BadgerPath       string        // The location for the badger database on disk.
+	BuntDBPath       string        // The location for the BuntDB database on disk.
+	BoltPath         string        // The bbolt database file, for the bolt package. Defaults to ./bolt.db.
+	FilePath         string        // The root directory of a file cache. Defaults to ./cache.
+	MemcachedServers []string      // Memcached servers (host:port), for the memcached package. Defaults to localhost:11211.
+	SQLDriver        string        // The database/sql driver name, for the sqlcache package, such as sqlite3 or pgx.
+	SQLDataSource    string        // The data source name passed to sql.Open.
+	SQLTable         string        // The table holding a sqlcache cache. Defaults to remember_cache.
+	SQLPurgeInterval time.Duration // How often a sqlcache cache deletes expired rows. Defaults to one minute.
+	ScanBatchSize    int           // The number of keys Redis examines per SCAN when emptying the cache. Defaults to 1000.
+	Codec            Codec         // The codec used to serialize values. Defaults to GobCodec.
+	MaxEntries       int           // The maximum number of entries held by a memory cache. 0 means no limit.
+	MaxBytes         int64         // The approximate maximum size in bytes of a memory cache's values. 0 means no limit.
+	Eviction         string        // The memory cache's eviction policy: EvictLRU (the default), EvictLFU or EvictARC.
+	Shards           int           // The number of independently locked shards in a memory cache. Defaults to 16.
+	Invalidation     bool          // If true, Redis publishes changes so that other processes can evict local copies.
 }
 
-// CacheEntry is a map to hold values, so we can serialize them.
+// CacheEntry is the map in which values were serialized by earlier versions of this package. It is
+// still understood when reading values which have no codec header.
 type CacheEntry map[string]any
 
-// New is a factory method which returns an instance of a CacheInterface.
+// New is a factory method which returns an instance of a CacheInterface of a registered cacheType:
+// redis, badger, buntdb, memory, or any type added with Register. Without options, the defaults for a
+// built-in cacheType, which are suitable for development, are used. Options which are supplied have any
+// missing server address or database path filled in with those defaults, and are then validated.
 func New(cacheType string, o ...*Options) (CacheInterface, error) {
-	var ops *Options
-	if len(o) > 0 {
-		ops = o[0]
-	} else {
-		switch cacheType {
-		case "redis":
-			ops = &Options{
-				Server:   "localhost",
-				Port:     "6379",
-				Password: "",
-				Prefix:   "dev",
-				DB:       0,
-			}
-
-		case "badger":
-			ops = &Options{
-				BadgerPath: "./badger",
-			}
-
-		case "buntdb":
-			ops = &Options{
-				BuntDBPath: ":memory:",
-			}
-		}
+	factory, ok := lookupFactory(cacheType)
+	if !ok {
+		return nil, fmt.Errorf("unsupported cache type %q", cacheType)
+	}
 
+	ops := defaultOptions(cacheType)
+	if len(o) > 0 && o[0] != nil {
+		ops = o[0].withDefaults(cacheType)
 	}
+	return factory(ops)
+}
 
-	switch cacheType {
-	case "redis":
-		client := redis.NewClient(&redis.Options{
-			Addr:     fmt.Sprintf("%s:%s", ops.Server, ops.Port),
-			Password: ops.Password,
-			DB:       ops.DB,
-		})
-		return &RedisCache{
-			Conn:   client,
-			Prefix: ops.Prefix,
-		}, nil
-
-	case "badger":
-		var t toolbox.Tools
-		_ = t.CreateDirIfNotExist(ops.BadgerPath)
-		client, err := badger.Open(badger.DefaultOptions(ops.BadgerPath))
+func init() {
+	_ = Register("redis", func(ops *Options) (CacheInterface, error) {
+		cache, err := newRedis(ops)
 		if err != nil {
 			return nil, err
 		}
-		return &BadgerCache{
-			Conn:   client,
-			Prefix: ops.Prefix,
-		}, nil
+		return cache, nil
+	})
+}
 
-	case "buntdb":
-		client, err := buntdb.Open(ops.BuntDBPath)
-		if err != nil {
-			return nil, err
-		}
-		return &BuntDBCache{
-			Conn:   client,
-			Prefix: ops.Prefix,
-		}, nil
+// newRedis validates ops and returns a Redis cache which owns its client.
+func newRedis(ops *Options) (*RedisCache, error) {
+	if err := ops.validate("redis"); err != nil {
+		return nil, err
+	}
 
-	default:
-		return nil, errors.New("unsupported cache type")
+	client, err := newRedisClient(ops)
+	if err != nil {
+		return nil, err
+	}
+	cache := NewRedisFromClient(client, ops)
+	cache.KeepOpen = false
+	return cache, nil
+}
+
+// NewRedisFromClient returns a cache which uses an existing Redis client, taking Prefix, Codec,
+// ScanBatchSize and Invalidation from the optional options. Close leaves the client open unless
+// KeepOpen is set to false.
+func NewRedisFromClient(client redis.UniversalClient, o ...*Options) *RedisCache {
+	ops := firstOptions(o)
+	return &RedisCache{
+		Conn:          client,
+		Prefix:        ops.Prefix,
+		Codec:         ops.Codec,
+		ScanBatchSize: ops.ScanBatchSize,
+		Invalidation:  ops.Invalidation,
+		KeepOpen:      true,
 	}
 }
 
-// Close closes the pool of redis connections
+// firstOptions returns the first of o, or empty options if there are none.
+func firstOptions(o []*Options) *Options {
+	if len(o) > 0 && o[0] != nil {
+		return o[0]
+	}
+	return &Options{}
+}
+
+// Close closes the pool of redis connections, unless KeepOpen is set.
 func (c *RedisCache) Close() error {
-	return c.Conn.Close()
+	if c.KeepOpen {
+		return nil
+	}
+	return wrapError(c.Conn.Close())
 }
 
 // Get attempts to retrieve a value from the cache.
 func (c *RedisCache) Get(key string) (any, error) {
-	ctx := context.Background()
+	return c.GetCtx(context.Background(), key)
+}
 
-	val, err := c.Conn.Get(ctx, fmt.Sprintf("%s:%s", c.Prefix, key)).Result()
+// GetCtx attempts to retrieve a value from the cache, using the supplied context for the call to Redis.
+func (c *RedisCache) GetCtx(ctx context.Context, key string) (any, error) {
+	val, err := c.Conn.Get(ctx, c.key(key)).Bytes()
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 
-	decoded, err := decode(val)
-	if err != nil {
-		return nil, err
-	}
-	item := decoded[key]
-	return item, nil
+	return DecodeValue(val)
 }
 
 // Set puts a value into Redis. The final parameter, expires, is optional.
 func (c *RedisCache) Set(key string, data any, expires ...time.Duration) error {
-	ctx := context.Background()
+	return c.SetCtx(context.Background(), key, data, expires...)
+}
 
+// SetCtx puts a value into Redis, using the supplied context for the call to Redis. The final
+// parameter, expires, is optional.
+func (c *RedisCache) SetCtx(ctx context.Context, key string, data any, expires ...time.Duration) error {
 	var expiration time.Duration
 	if len(expires) > 0 {
 		expiration = expires[0]
 	}
 
-	entry := CacheEntry{}
-	entry[key] = data
-	encoded, err := encode(entry)
+	encoded, err := EncodeValue(c.Codec, data)
 	if err != nil {
 		return err
 	}
 
-	return c.Conn.Set(ctx, fmt.Sprintf("%s:%s", c.Prefix, key), string(encoded), expiration).Err()
+	err = c.Conn.Set(ctx, c.key(key), encoded, expiration).Err()
+	if err != nil {
+		return wrapError(err)
+	}
+
+	return c.publish(ctx, Invalidation{Keys: []string{key}})
+}
+
+// Remember returns the value stored at key. If the key is not in the cache, fn is called to compute
+// the value, which is stored with the given ttl (0 means no expiry) and returned. Concurrent misses
+// for the same key within this process share a single call to fn.
+func (c *RedisCache) Remember(key string, ttl time.Duration, fn func() (any, error)) (any, error) {
+	return Remember(c, &c.group, key, ttl, fn)
 }
 
 // GetInt is a convenience method which retrieves a value from the cache, converts it to an int, and returns it.
 func (c *RedisCache) GetInt(key string) (int, error) {
-	val, err := c.Get(key)
-	if err != nil {
-		return 0, err
-	}
-
-	return val.(int), nil
+	return GetInt(c, key)
 }
 
 // GetString is a convenience method which retrieves a value from the cache and returns it as a string.
 func (c *RedisCache) GetString(key string) (string, error) {
-	s, err := c.Get(key)
-	if err != nil {
-		return "", err
-	}
-	return s.(string), nil
+	return GetAs[string](c, key)
 }
 
 // Forget removes an item from the cache, by key.
 func (c *RedisCache) Forget(key string) error {
-	ctx := context.Background()
-	return c.Conn.Del(ctx, fmt.Sprintf("%s:%s", c.Prefix, key)).Err()
+	return c.ForgetCtx(context.Background(), key)
+}
+
+// ForgetCtx removes an item from the cache, by key, using the supplied context for the call to Redis.
+func (c *RedisCache) ForgetCtx(ctx context.Context, key string) error {
+	err := c.Conn.Del(ctx, c.key(key)).Err()
+	if err != nil {
+		return wrapError(err)
+	}
+
+	return c.publish(ctx, Invalidation{Keys: []string{key}})
 }
 
 // Has checks to see if the supplied key is in the cache and returns true if found, otherwise false.
 func (c *RedisCache) Has(key string) bool {
-	ctx := context.Background()
+	return c.HasCtx(context.Background(), key)
+}
 
-	res, err := c.Conn.Exists(ctx, fmt.Sprintf("%s:%s", c.Prefix, key)).Result()
+// HasCtx checks to see if the supplied key is in the cache, using the supplied context for the
+// call to Redis.
+func (c *RedisCache) HasCtx(ctx context.Context, key string) bool {
+	res, err := c.Conn.Exists(ctx, c.key(key)).Result()
 	if res == 0 || err != nil {
 		return false
 	}
@@ -198,73 +281,401 @@ func (c *RedisCache) Has(key string) bool {
 
 // GetTime retrieves a value from the cache by the specified key and returns it as time.Time.
 func (c *RedisCache) GetTime(key string) (time.Time, error) {
-	fromCache, err := c.Get(key)
-	if err != nil {
-		return time.Time{}, err
-	}
-
-	t := fromCache.(time.Time)
-	return t, nil
+	return GetAs[time.Time](c, key)
 }
 
 // EmptyByMatch removes all entries in Redis which have the prefix match.
 func (c *RedisCache) EmptyByMatch(match string) error {
-	ctx := context.Background()
+	return c.EmptyByMatchCtx(context.Background(), match)
+}
 
-	res, err := c.Conn.Keys(ctx, fmt.Sprintf("%s:%s*", c.Prefix, match)).Result()
+// EmptyByMatchCtx removes all entries in Redis which have the prefix match, using the supplied
+// context for the calls to Redis. Keys are found with an incremental SCAN, rather than KEYS, so the
+// server is never blocked, and each batch is removed with a single pipeline of UNLINK commands. In
+// cluster mode, every master node is scanned, concurrently.
+func (c *RedisCache) EmptyByMatchCtx(ctx context.Context, match string) error {
+	pattern := fmt.Sprintf("%s:%s*", c.Prefix, match)
+
+	var mu sync.Mutex
+	deleted := 0
+	progress := func(n int) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		deleted += n
+		if c.OnProgress != nil {
+			c.OnProgress(deleted)
+		}
+	}
+
+	var err error
+	if cluster, ok := c.Conn.(*redis.ClusterClient); ok {
+		err = cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return c.unlinkMatching(ctx, node, pattern, progress)
+		})
+	} else {
+		err = c.unlinkMatching(ctx, c.Conn, pattern, progress)
+	}
 	if err != nil {
-		return err
+		return wrapError(err)
 	}
 
-	for _, x := range res {
-		err := c.Conn.Del(ctx, x).Err()
+	return c.publish(ctx, Invalidation{Prefixes: []string{match}})
+}
+
+// unlinkMatching scans a single Redis node for keys matching pattern and removes them, calling
+// progress with the size of each batch.
+func (c *RedisCache) unlinkMatching(ctx context.Context, node redis.Cmdable, pattern string, progress func(int)) error {
+	batchSize := c.ScanBatchSize
+	if batchSize <= 0 {
+		batchSize = defaultScanBatchSize
+	}
+
+	var cursor uint64
+	for {
+		keys, next, err := node.Scan(ctx, cursor, pattern, int64(batchSize)).Result()
 		if err != nil {
 			return err
 		}
-	}
 
-	return nil
+		if len(keys) > 0 {
+			_, err = node.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				for _, key := range keys {
+					pipe.Unlink(ctx, key)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			progress(len(keys))
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
 }
 
 // Empty removes all entries in Redis for a given client.
 func (c *RedisCache) Empty() error {
+	return c.EmptyCtx(context.Background())
+}
+
+// EmptyCtx removes all entries in Redis for a given client, using the supplied context for the
+// calls to Redis.
+func (c *RedisCache) EmptyCtx(ctx context.Context) error {
+	return c.EmptyByMatchCtx(ctx, "")
+}
+
+// GetMany retrieves several values from Redis with a single MGET, or in cluster mode, where the keys
+// may live on different nodes, a pipeline of GETs. Keys which are not in the cache are omitted from
+// the returned map.
+func (c *RedisCache) GetMany(keys []string) (map[string]any, error) {
 	ctx := context.Background()
+	result := make(map[string]any, len(keys))
+	if len(keys) == 0 {
+		return result, nil
+	}
+
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = c.key(key)
+	}
 
-	res, err := c.Conn.Keys(ctx, fmt.Sprintf("%s:*", c.Prefix)).Result()
+	vals, err := c.mget(ctx, prefixed)
 	if err != nil {
-		return err
+		return nil, wrapError(err)
 	}
 
-	for _, x := range res {
-		err := c.Conn.Del(ctx, x).Err()
+	for i, val := range vals {
+		s, ok := val.(string)
+		if !ok {
+			continue
+		}
+
+		item, err := DecodeValue([]byte(s))
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("key %s: %w", keys[i], err)
+		}
+		result[keys[i]] = item
+	}
+
+	return result, nil
+}
+
+// SetMany puts several values into Redis using a single pipeline. The final parameter, expires, is
+// optional, and applies to every item.
+func (c *RedisCache) SetMany(items map[string]any, expires ...time.Duration) error {
+	ctx := context.Background()
+
+	var expiration time.Duration
+	if len(expires) > 0 {
+		expiration = expires[0]
+	}
+
+	encoded := make(map[string][]byte, len(items))
+	for key, data := range items {
+		b, err := EncodeValue(c.Codec, data)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", key, err)
 		}
+		encoded[key] = b
+	}
+
+	keys := make([]string, 0, len(encoded))
+	_, err := c.Conn.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key, b := range encoded {
+			pipe.Set(ctx, c.key(key), b, expiration)
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return wrapError(err)
+	}
+
+	return c.publish(ctx, Invalidation{Keys: keys})
+}
+
+// ForgetMany removes several items from the cache with a single DEL, or in cluster mode a pipeline of
+// DELs.
+func (c *RedisCache) ForgetMany(keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = c.key(key)
+	}
+
+	ctx := context.Background()
+	var err error
+	if _, ok := c.Conn.(*redis.ClusterClient); ok {
+		_, err = c.Conn.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, key := range prefixed {
+				pipe.Del(ctx, key)
+			}
+			return nil
+		})
+	} else {
+		err = c.Conn.Del(ctx, prefixed...).Err()
+	}
+	if err != nil {
+		return wrapError(err)
+	}
+
+	return c.publish(ctx, Invalidation{Keys: keys})
+}
+
+// incrementScript adds ARGV[1] to the counter at KEYS[1], first creating it with a TTL of ARGV[2]
+// milliseconds if it is missing and ARGV[2] is not 0. It returns nil if the key holds anything other
+// than a counter. The new value is returned as read back with GET, since Lua numbers cannot hold
+// every int64.
+var incrementScript = redis.NewScript(`
+local t = redis.call('TYPE', KEYS[1]).ok
+if t == 'none' then
+	if ARGV[2] ~= '0' then
+		redis.call('SET', KEYS[1], 0, 'PX', ARGV[2])
+	end
+elseif t ~= 'string' then
+	return false
+else
+	local v = redis.call('GET', KEYS[1])
+	if v ~= '0' and not string.match(v, '^-?[1-9]%d*$') then
+		return false
+	end
+end
+redis.call('INCRBY', KEYS[1], ARGV[1])
+return redis.call('GET', KEYS[1])
+`)
+
+// Increment atomically adds delta to the counter stored at key, using INCRBY, and returns the new value.
+// A missing key is treated as 0. The optional ttl is applied only when the counter is created; an
+// existing counter keeps its expiry.
+func (c *RedisCache) Increment(key string, delta int64, ttl ...time.Duration) (int64, error) {
+	ctx := context.Background()
+
+	val, err := incrementScript.Run(ctx, c.Conn, []string{c.key(key)}, delta, CounterTTL(ttl).Milliseconds()).Text()
+	if errors.Is(err, redis.Nil) {
+		return 0, fmt.Errorf("%w: key %s", ErrNotInteger, key)
+	}
+	if err != nil {
+		return 0, wrapError(err)
 	}
 
+	n, err := ParseCounter(key, []byte(val))
+	if err != nil {
+		return 0, err
+	}
+	return n, c.publish(ctx, Invalidation{Keys: []string{key}})
+}
+
+// Decrement atomically subtracts delta from the counter stored at key, and returns the new value. See
+// Increment.
+func (c *RedisCache) Decrement(key string, delta int64, ttl ...time.Duration) (int64, error) {
+	return c.Increment(key, -delta, ttl...)
+}
+
+// TTL returns the time remaining before key expires, or NoExpiration if it never expires.
+func (c *RedisCache) TTL(key string) (time.Duration, error) {
+	ttl, err := c.Conn.PTTL(context.Background(), c.key(key)).Result()
+	if err != nil {
+		return 0, wrapError(err)
+	}
+
+	switch ttl {
+	case -2:
+		return 0, ErrNotFound
+	case -1:
+		return NoExpiration, nil
+	default:
+		return ttl, nil
+	}
+}
+
+// Touch sets the time remaining before key expires to ttl, without rewriting its value. This allows
+// sliding expiration, for example of sessions.
+func (c *RedisCache) Touch(key string, ttl time.Duration) error {
+	ok, err := c.Conn.PExpire(context.Background(), c.key(key), ttl).Result()
+	if err != nil {
+		return wrapError(err)
+	}
+	if !ok {
+		return ErrNotFound
+	}
 	return nil
 }
 
-// encode serializes a CacheEntry for storage in the cache.
-func encode(item CacheEntry) ([]byte, error) {
-	b := bytes.Buffer{}
-	e := gob.NewEncoder(&b)
-	err := e.Encode(item)
+// Persist removes the expiry from key, so that it never expires.
+func (c *RedisCache) Persist(key string) error {
+	ctx := context.Background()
+
+	ok, err := c.Conn.Persist(ctx, c.key(key)).Result()
 	if err != nil {
+		return wrapError(err)
+	}
+	if !ok && !c.HasCtx(ctx, key) {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// mget returns the raw values of keys, with nil for those which do not exist.
+func (c *RedisCache) mget(ctx context.Context, keys []string) ([]any, error) {
+	if _, ok := c.Conn.(*redis.ClusterClient); !ok {
+		return c.Conn.MGet(ctx, keys...).Result()
+	}
+
+	cmds := make([]*redis.StringCmd, len(keys))
+	_, err := c.Conn.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Get(ctx, key)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
 		return nil, err
 	}
-	return b.Bytes(), nil
+
+	vals := make([]any, len(keys))
+	for i, cmd := range cmds {
+		if val, err := cmd.Result(); err == nil {
+			vals[i] = val
+		}
+	}
+	return vals, nil
 }
 
-// decode deserializes an item into a map[string]any.
-func decode(str string) (CacheEntry, error) {
-	item := CacheEntry{}
-	b := bytes.Buffer{}
-	b.Write([]byte(str))
-	d := gob.NewDecoder(&b)
-	err := d.Decode(&item)
+// key returns the key as stored in Redis, including this client's prefix.
+func (c *RedisCache) key(key string) string {
+	return fmt.Sprintf("%s:%s", c.Prefix, key)
+}
+
+// Remember implements CacheInterface.Remember for c, sharing concurrent misses through g. The cache is
+// checked once before and once inside the singleflight group, so a caller arriving just after another
+// has populated the key does not call fn again. Only ErrNotFound counts as a miss; any other error is
+// returned as is.
+func Remember(c CacheInterface, g *singleflight.Group, key string, ttl time.Duration, fn func() (any, error)) (any, error) {
+	val, err := c.Get(key)
+	if err == nil || !errors.Is(err, ErrNotFound) {
+		return val, err
+	}
+
+	val, err, _ = g.Do(key, func() (any, error) {
+		val, err := c.Get(key)
+		if err == nil || !errors.Is(err, ErrNotFound) {
+			return val, err
+		}
+
+		val, err = fn()
+		if err != nil {
+			return nil, err
+		}
+
+		var expires []time.Duration
+		if ttl > 0 {
+			expires = append(expires, ttl)
+		}
+
+		if err := c.Set(key, val, expires...); err != nil {
+			return nil, err
+		}
+		return val, nil
+	})
+
+	return val, err
+}
+
+// EncodeValue serializes a value for storage in the cache using codec, or GobCodec if codec is nil, and
+// prefixes it with a header identifying the codec.
+func EncodeValue(codec Codec, value any) ([]byte, error) {
+	if codec == nil {
+		codec = GobCodec{}
+	}
+
+	data, err := codec.Marshal(value)
 	if err != nil {
 		return nil, err
 	}
-	return item, nil
+
+	return append([]byte{codecMarker, codec.ID()}, data...), nil
+}
+
+// DecodeValue deserializes a value from the cache, using the codec named in its header. Values without a
+// header are either counters, which are returned as int64, or were written by earlier versions of this
+// package as a gob encoded CacheEntry. Failures are reported as ErrDecode. EncodeValue and
+// DecodeValue are exported for packages which provide a backend, so that values are stored in the same
+// form by every cache type.
+func DecodeValue(data []byte) (any, error) {
+	if len(data) >= 2 && data[0] == codecMarker {
+		codec, ok := lookupCodec(data[1])
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown codec id %d", ErrDecode, data[1])
+		}
+
+		val, err := codec.Unmarshal(data[2:])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrDecode, err)
+		}
+		return val, nil
+	}
+
+	if n, err := strconv.ParseInt(string(data), 10, 64); err == nil {
+		return n, nil
+	}
+
+	item := CacheEntry{}
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&item)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecode, err)
+	}
+
+	var val any
+	for _, v := range item {
+		val = v
+	}
+	return val, nil
 }
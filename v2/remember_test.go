@@ -1,9 +1,19 @@
 package remember
 
 import (
+	"context"
 	"encoding/gob"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
 )
 
 func TestNew(t *testing.T) {
@@ -19,7 +29,8 @@ func TestNew(t *testing.T) {
 		t.Error("error", err)
 	}
 
-	c2, _ := New("redis")
+	s := miniredis.RunT(t)
+	c2, _ := New("redis", &Options{Server: s.Host(), Port: s.Port()})
 	err = c2.Set("foo", "bar")
 	if err != nil {
 		t.Error("error", err)
@@ -260,6 +271,114 @@ func TestEmptyByMatch(t *testing.T) {
 	testRedisCache.Empty()
 }
 
+// heldUnlinks is a go-redis hook which records the keys in pipelines of UNLINK commands instead of
+// sending them, until flush removes them from miniredis. miniredis pages SCAN by position in its
+// sorted list of keys, so removing keys during a scan makes it skip others; real Redis returns every
+// key which exists for the whole scan.
+type heldUnlinks struct {
+	s    *miniredis.Miniredis
+	mu   sync.Mutex
+	keys []string
+}
+
+func (h *heldUnlinks) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *heldUnlinks) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return next
+}
+
+func (h *heldUnlinks) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			if cmd.Name() != "unlink" {
+				return next(ctx, cmds)
+			}
+		}
+
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		for _, cmd := range cmds {
+			h.keys = append(h.keys, fmt.Sprint(cmd.Args()[1]))
+			cmd.(*redis.IntCmd).SetVal(1)
+		}
+		return nil
+	}
+}
+
+// flush removes the keys recorded so far.
+func (h *heldUnlinks) flush() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, key := range h.keys {
+		h.s.Del(key)
+	}
+	h.keys = nil
+}
+
+func TestEmptyByMatchLarge(t *testing.T) {
+	unlinks := &heldUnlinks{s: testRedis}
+	conn := redis.NewClient(&redis.Options{Addr: testRedis.Addr()})
+	conn.AddHook(unlinks)
+	defer conn.Close()
+
+	c := &RedisCache{
+		Conn:          conn,
+		Prefix:        "test_large",
+		ScanBatchSize: 500,
+	}
+
+	var reports []int
+	c.OnProgress = func(deleted int) {
+		reports = append(reports, deleted)
+	}
+
+	const total = 20000
+	for i := 0; i < total; i++ {
+		testRedis.Set(fmt.Sprintf("test_large:item%d", i), "x")
+	}
+	testRedis.Set("test_large:other", "x")
+	testRedis.Set("test_other:item1", "x")
+
+	err := c.EmptyByMatch("item")
+	if err != nil {
+		t.Error(err)
+	}
+	unlinks.flush()
+
+	if len(reports) < 2 {
+		t.Errorf("expected progress to be reported for several batches, got %d reports", len(reports))
+	}
+	if len(reports) > 0 && reports[len(reports)-1] != total {
+		t.Errorf("expected final progress report of %d, got %d", total, reports[len(reports)-1])
+	}
+
+	for _, k := range testRedis.Keys() {
+		if strings.HasPrefix(k, "test_large:item") {
+			t.Fatal("key was not removed:", k)
+		}
+	}
+
+	if !testRedis.Exists("test_large:other") || !testRedis.Exists("test_other:item1") {
+		t.Error("keys not matching the prefix were removed")
+	}
+
+	err = c.Empty()
+	if err != nil {
+		t.Error(err)
+	}
+	unlinks.flush()
+	if testRedis.Exists("test_large:other") {
+		t.Error("Empty did not remove all keys for the prefix")
+	}
+	if !testRedis.Exists("test_other:item1") {
+		t.Error("Empty removed a key belonging to another prefix")
+	}
+	testRedis.Del("test_other:item1")
+}
+
 func TestEmpty(t *testing.T) {
 	err := testRedisCache.Set("x", "y")
 	if err != nil {
@@ -281,6 +400,276 @@ func TestEmpty(t *testing.T) {
 	}
 }
 
+func TestRemember(t *testing.T) {
+	var calls int32
+	loader := func() (any, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		return "computed", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			x, err := testRedisCache.Remember("remembered", time.Minute, loader)
+			if err != nil {
+				t.Error(err)
+			}
+			if x != "computed" {
+				t.Error("wrong value returned from Remember:", x)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("expected loader to be called once, but it was called %d times", calls)
+	}
+
+	x, err := testRedisCache.Get("remembered")
+	if err != nil {
+		t.Error(err)
+	}
+	if x != "computed" {
+		t.Error("value from Remember was not stored in the cache")
+	}
+
+	_, err = testRedisCache.Remember("failed", time.Minute, func() (any, error) {
+		return nil, errors.New("boom")
+	})
+	if err == nil {
+		t.Error("expected error from loader but did not get one")
+	}
+	if testRedisCache.Has("failed") {
+		t.Error("failed load should not be stored in the cache")
+	}
+
+	testRedisCache.Empty()
+}
+
+func TestContext(t *testing.T) {
+	c, ok := testRedisCache.(ContextCacheInterface)
+	if !ok {
+		t.Fatal("cache does not implement ContextCacheInterface")
+	}
+
+	ctx := context.Background()
+	err := c.SetCtx(ctx, "ctxkey", "ctxval")
+	if err != nil {
+		t.Error(err)
+	}
+
+	x, err := c.GetCtx(ctx, "ctxkey")
+	if err != nil {
+		t.Error(err)
+	}
+	if x != "ctxval" {
+		t.Error("wrong value retrieved from cache:", x)
+	}
+
+	if !c.HasCtx(ctx, "ctxkey") {
+		t.Error("ctxkey should be in the cache")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if err := c.SetCtx(cancelled, "ctxkey2", "ctxval"); !errors.Is(err, context.Canceled) {
+		t.Error("expected context.Canceled from SetCtx, got", err)
+	}
+
+	if err := c.EmptyByMatchCtx(cancelled, "ctx"); !errors.Is(err, context.Canceled) {
+		t.Error("expected context.Canceled from EmptyByMatchCtx, got", err)
+	}
+
+	if !c.Has("ctxkey") {
+		t.Error("cancelled EmptyByMatchCtx should not have removed ctxkey")
+	}
+
+	if err := c.ForgetCtx(ctx, "ctxkey"); err != nil {
+		t.Error(err)
+	}
+	if c.HasCtx(ctx, "ctxkey") {
+		t.Error("ctxkey should have been removed from the cache")
+	}
+
+	if err := c.EmptyCtx(ctx); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMany(t *testing.T) {
+	items := map[string]any{
+		"many1": "one",
+		"many2": 2,
+		"many3": "three",
+	}
+
+	err := testRedisCache.SetMany(items, time.Minute)
+	if err != nil {
+		t.Error(err)
+	}
+
+	found, err := testRedisCache.GetMany([]string{"many1", "many2", "many3", "missing"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(found) != 3 {
+		t.Errorf("expected 3 values, got %d", len(found))
+	}
+	for k, v := range items {
+		if found[k] != v {
+			t.Errorf("wrong value for %s; expected %v but got %v", k, v, found[k])
+		}
+	}
+	if _, ok := found["missing"]; ok {
+		t.Error("missing key should not be in the result")
+	}
+
+	err = testRedisCache.ForgetMany([]string{"many1", "many2", "missing"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if testRedisCache.Has("many1") || testRedisCache.Has("many2") {
+		t.Error("ForgetMany did not remove keys")
+	}
+	if !testRedisCache.Has("many3") {
+		t.Error("ForgetMany removed a key it was not given")
+	}
+
+	found, err = testRedisCache.GetMany(nil)
+	if err != nil || len(found) != 0 {
+		t.Error("expected an empty result for no keys")
+	}
+
+	testRedisCache.Empty()
+}
+
+func TestIncrement(t *testing.T) {
+	n, err := testRedisCache.Increment("counter", 5, time.Minute)
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 5 {
+		t.Errorf("expected 5, got %d", n)
+	}
+
+	n, err = testRedisCache.Decrement("counter", 2)
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 3 {
+		t.Errorf("expected 3, got %d", n)
+	}
+
+	i, err := testRedisCache.GetInt("counter")
+	if err != nil {
+		t.Error(err)
+	}
+	if i != 3 {
+		t.Errorf("expected GetInt to return 3, got %d", i)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := testRedisCache.Increment("counter", 1); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	x, err := testRedisCache.Get("counter")
+	if err != nil {
+		t.Error(err)
+	}
+	if x != int64(23) {
+		t.Errorf("expected 23 after concurrent increments, got %v", x)
+	}
+
+	_ = testRedisCache.Set("notcounter", "bar")
+	_, err = testRedisCache.Increment("notcounter", 1)
+	if !errors.Is(err, ErrNotInteger) {
+		t.Error("expected ErrNotInteger, got", err)
+	}
+
+	_, _ = testRedis.ZAdd("test_cache:zset", 1, "member")
+	_, err = testRedisCache.Increment("zset", 1)
+	if !errors.Is(err, ErrNotInteger) {
+		t.Error("expected ErrNotInteger for a key of another type, got", err)
+	}
+
+	n, err = testRedisCache.Increment("big", math.MaxInt64-1)
+	if err == nil {
+		n, err = testRedisCache.Increment("big", 1)
+	}
+	if err != nil || n != math.MaxInt64 {
+		t.Errorf("expected %d, got %d (%v)", int64(math.MaxInt64), n, err)
+	}
+
+	testRedisCache.Empty()
+}
+
+func TestTTL(t *testing.T) {
+	_ = testRedisCache.Set("ttl", "x", time.Hour)
+
+	ttl, err := testRedisCache.TTL("ttl")
+	if err != nil {
+		t.Error(err)
+	}
+	if ttl < time.Hour-5*time.Second || ttl > time.Hour {
+		t.Errorf("expected ttl of about an hour, got %s", ttl)
+	}
+
+	err = testRedisCache.Touch("ttl", 2*time.Hour)
+	if err != nil {
+		t.Error(err)
+	}
+	ttl, _ = testRedisCache.TTL("ttl")
+	if ttl < 2*time.Hour-5*time.Second || ttl > 2*time.Hour {
+		t.Errorf("expected ttl of about two hours after Touch, got %s", ttl)
+	}
+
+	err = testRedisCache.Persist("ttl")
+	if err != nil {
+		t.Error(err)
+	}
+	ttl, _ = testRedisCache.TTL("ttl")
+	if ttl != NoExpiration {
+		t.Errorf("expected NoExpiration after Persist, got %s", ttl)
+	}
+
+	x, _ := testRedisCache.Get("ttl")
+	if x != "x" {
+		t.Error("value changed by Touch or Persist:", x)
+	}
+
+	_, _ = testRedisCache.Increment("ttlcounter", 1, time.Minute)
+	ttl, _ = testRedisCache.TTL("ttlcounter")
+	if ttl <= 0 || ttl > time.Minute {
+		t.Errorf("expected new counter to expire within a minute, got %s", ttl)
+	}
+
+	if _, err := testRedisCache.TTL("missing"); !errors.Is(err, ErrNotFound) {
+		t.Error("expected ErrNotFound from TTL, got", err)
+	}
+	if err := testRedisCache.Touch("missing", time.Minute); !errors.Is(err, ErrNotFound) {
+		t.Error("expected ErrNotFound from Touch, got", err)
+	}
+	if err := testRedisCache.Persist("missing"); !errors.Is(err, ErrNotFound) {
+		t.Error("expected ErrNotFound from Persist, got", err)
+	}
+
+	testRedisCache.Empty()
+}
+
 func TestClose(t *testing.T) {
 	err := testRedisCache.Close()
 	if err != nil {
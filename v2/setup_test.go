@@ -4,6 +4,7 @@ import (
 	"github.com/alicebob/miniredis/v2"
 	"log"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -32,15 +33,50 @@ func TestMain(m *testing.M) {
 	testBuntdbCache, _ = New("buntdb")
 	defer testBuntdbCache.Close()
 
-	m.Run()
+	code := m.Run()
 	cleanup()
 
-	os.Exit(0)
+	os.Exit(code)
 }
 
 func cleanup() {
-	err := os.RemoveAll("./testdata/badger")
+	err := os.RemoveAll("./testdata")
 	if err != nil {
 		log.Println("ERROR", err)
 	}
 }
+
+// testBackend is a cache which a test runs against, named for error messages.
+type testBackend struct {
+	name  string
+	cache CacheInterface
+}
+
+// newTestBackends returns new Redis, Badger and BuntDB caches, which are closed when the test ends,
+// along with the miniredis server behind the Redis cache. Tests which close or empty their caches
+// use these, rather than the shared caches set up by TestMain.
+func newTestBackends(t *testing.T) ([]testBackend, *miniredis.Miniredis) {
+	t.Helper()
+
+	s := miniredis.RunT(t)
+	redisCache, err := NewRedis(WithAddr(s.Addr()), WithPrefix("test_cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	badgerCache, err := NewBadger(WithBadgerPath(filepath.Join(t.TempDir(), "badger")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buntdbCache, err := NewBuntDB(WithBuntDBPath(":memory:"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backends := []testBackend{{"redis", redisCache}, {"badger", badgerCache}, {"buntdb", buntdbCache}}
+	t.Cleanup(func() {
+		for _, b := range backends {
+			_ = b.cache.Close()
+		}
+	})
+	return backends, s
+}
@@ -0,0 +1,351 @@
+package remember
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// ShardedCache spreads keys over several independent caches, such as Redis nodes which are not part of
+// a cluster. Each key belongs to the shard chosen by rendezvous (highest random weight) hashing of the
+// key and the shards' names, so adding a shard moves only the keys which now belong to it, and
+// removing one moves only the keys which belonged to it. Operations on several keys are grouped by
+// shard, and Empty and EmptyByMatch run on every shard in parallel.
+type ShardedCache struct {
+	mu     sync.RWMutex
+	names  []string
+	shards map[string]CacheInterface
+	group  singleflight.Group
+}
+
+// NewSharded returns a ShardedCache over shards, which are identified by name. Names, rather than
+// addresses, decide where keys go, so a shard can move to another server without remapping its keys.
+func NewSharded(shards map[string]CacheInterface) *ShardedCache {
+	s := &ShardedCache{shards: make(map[string]CacheInterface, len(shards))}
+	for name, cache := range shards {
+		s.names = append(s.names, name)
+		s.shards[name] = cache
+	}
+	sort.Strings(s.names)
+	return s
+}
+
+// AddShard adds a cache under name. The keys which now belong to it are not copied from the shards
+// which held them before, so they are misses until they are written again.
+func (s *ShardedCache) AddShard(name string, cache CacheInterface) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.shards[name]; ok {
+		return fmt.Errorf("shard %q already exists", name)
+	}
+	s.shards[name] = cache
+	s.names = append(s.names, name)
+	sort.Strings(s.names)
+	return nil
+}
+
+// RemoveShard stops using the shard with the given name, and returns it so that the caller can close
+// it. Its keys are spread over the remaining shards.
+func (s *ShardedCache) RemoveShard(name string) (CacheInterface, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cache, ok := s.shards[name]
+	if !ok {
+		return nil, fmt.Errorf("shard %q does not exist", name)
+	}
+	delete(s.shards, name)
+	for i, n := range s.names {
+		if n == name {
+			s.names = append(s.names[:i], s.names[i+1:]...)
+			break
+		}
+	}
+	return cache, nil
+}
+
+// ShardFor returns the name of the shard which holds key.
+func (s *ShardedCache) ShardFor(key string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.owner(key)
+}
+
+// owner returns the name of the shard with the highest weight for key. The lock must be held.
+func (s *ShardedCache) owner(key string) string {
+	var best string
+	var bestWeight uint64
+	for i, name := range s.names {
+		if w := rendezvousWeight(name, key); i == 0 || w > bestWeight {
+			best, bestWeight = name, w
+		}
+	}
+	return best
+}
+
+// shard returns the cache which holds key.
+func (s *ShardedCache) shard(key string) (CacheInterface, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.names) == 0 {
+		return nil, errors.New("sharded cache has no shards")
+	}
+	return s.shards[s.owner(key)], nil
+}
+
+// byShard groups keys by the shard which holds them.
+func (s *ShardedCache) byShard(keys []string) ([]shardGroup, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.names) == 0 && len(keys) > 0 {
+		return nil, errors.New("sharded cache has no shards")
+	}
+
+	byName := make(map[string][]string)
+	for _, key := range keys {
+		name := s.owner(key)
+		byName[name] = append(byName[name], key)
+	}
+
+	groups := make([]shardGroup, 0, len(byName))
+	for name, keys := range byName {
+		groups = append(groups, shardGroup{cache: s.shards[name], keys: keys})
+	}
+	return groups, nil
+}
+
+// all returns every shard.
+func (s *ShardedCache) all() []CacheInterface {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	caches := make([]CacheInterface, 0, len(s.names))
+	for _, name := range s.names {
+		caches = append(caches, s.shards[name])
+	}
+	return caches
+}
+
+// fanOut calls fn for every item in parallel, and returns the errors of all of the calls which failed.
+func fanOut[T any](items []T, fn func(T) error) error {
+	errs := make([]error, len(items))
+
+	var wg sync.WaitGroup
+	for i, item := range items {
+		wg.Add(1)
+		go func(i int, item T) {
+			defer wg.Done()
+			errs[i] = fn(item)
+		}(i, item)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// rendezvousWeight returns the weight of shard name for key. FNV-1a alone mixes short inputs poorly,
+// so its result is passed through the SplitMix64 finalizer.
+func rendezvousWeight(name, key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(key))
+
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Has checks to see if the supplied key is in the cache and returns true if found, otherwise false.
+func (s *ShardedCache) Has(key string) bool {
+	c, err := s.shard(key)
+	return err == nil && c.Has(key)
+}
+
+// Close closes every shard.
+func (s *ShardedCache) Close() error {
+	return fanOut(s.all(), func(c CacheInterface) error { return c.Close() })
+}
+
+// Get attempts to retrieve a value from the cache.
+func (s *ShardedCache) Get(key string) (any, error) {
+	c, err := s.shard(key)
+	if err != nil {
+		return nil, err
+	}
+	return c.Get(key)
+}
+
+// Set puts a value into the cache. The final parameter, expires, is optional.
+func (s *ShardedCache) Set(key string, value any, expires ...time.Duration) error {
+	c, err := s.shard(key)
+	if err != nil {
+		return err
+	}
+	return c.Set(key, value, expires...)
+}
+
+// Remember returns the value stored at key. If the key is not in the cache, fn is called to compute
+// the value, which is stored with the given ttl (0 means no expiry) and returned. Concurrent misses
+// for the same key share a single call to fn.
+func (s *ShardedCache) Remember(key string, ttl time.Duration, fn func() (any, error)) (any, error) {
+	return Remember(s, &s.group, key, ttl, fn)
+}
+
+// Forget removes an item from the cache, by key.
+func (s *ShardedCache) Forget(key string) error {
+	c, err := s.shard(key)
+	if err != nil {
+		return err
+	}
+	return c.Forget(key)
+}
+
+// GetMany retrieves several values, with one GetMany per shard, run in parallel. Keys which are not in
+// the cache are omitted from the returned map.
+func (s *ShardedCache) GetMany(keys []string) (map[string]any, error) {
+	groups, err := s.byShard(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	result := make(map[string]any, len(keys))
+	err = fanOut(groups, func(g shardGroup) error {
+		values, err := g.cache.GetMany(g.keys)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		for key, val := range values {
+			result[key] = val
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SetMany puts several values into the cache, with one SetMany per shard, run in parallel. The final
+// parameter, expires, is optional, and applies to every item.
+func (s *ShardedCache) SetMany(items map[string]any, expires ...time.Duration) error {
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+
+	groups, err := s.byShard(keys)
+	if err != nil {
+		return err
+	}
+
+	return fanOut(groups, func(g shardGroup) error {
+		subset := make(map[string]any, len(g.keys))
+		for _, key := range g.keys {
+			subset[key] = items[key]
+		}
+		return g.cache.SetMany(subset, expires...)
+	})
+}
+
+// ForgetMany removes several items from the cache, with one ForgetMany per shard, run in parallel.
+func (s *ShardedCache) ForgetMany(keys []string) error {
+	groups, err := s.byShard(keys)
+	if err != nil {
+		return err
+	}
+
+	return fanOut(groups, func(g shardGroup) error {
+		return g.cache.ForgetMany(g.keys)
+	})
+}
+
+// EmptyByMatch removes all entries which have the prefix match from every shard, in parallel.
+func (s *ShardedCache) EmptyByMatch(match string) error {
+	return fanOut(s.all(), func(c CacheInterface) error { return c.EmptyByMatch(match) })
+}
+
+// Empty removes all entries from every shard, in parallel.
+func (s *ShardedCache) Empty() error {
+	return fanOut(s.all(), func(c CacheInterface) error { return c.Empty() })
+}
+
+// Increment atomically adds delta to the int64 counter stored at key, and returns the new value. See
+// the Increment method of the shard's cache type.
+func (s *ShardedCache) Increment(key string, delta int64, ttl ...time.Duration) (int64, error) {
+	c, err := s.shard(key)
+	if err != nil {
+		return 0, err
+	}
+	return c.Increment(key, delta, ttl...)
+}
+
+// Decrement atomically subtracts delta from the counter stored at key, and returns the new value.
+func (s *ShardedCache) Decrement(key string, delta int64, ttl ...time.Duration) (int64, error) {
+	return s.Increment(key, -delta, ttl...)
+}
+
+// TTL returns the time remaining before key expires, or NoExpiration if it never expires.
+func (s *ShardedCache) TTL(key string) (time.Duration, error) {
+	c, err := s.shard(key)
+	if err != nil {
+		return 0, err
+	}
+	return c.TTL(key)
+}
+
+// Touch sets the time remaining before key expires to ttl.
+func (s *ShardedCache) Touch(key string, ttl time.Duration) error {
+	c, err := s.shard(key)
+	if err != nil {
+		return err
+	}
+	return c.Touch(key, ttl)
+}
+
+// Persist removes the expiry from key, so that it never expires.
+func (s *ShardedCache) Persist(key string) error {
+	c, err := s.shard(key)
+	if err != nil {
+		return err
+	}
+	return c.Persist(key)
+}
+
+// GetInt is a convenience method which retrieves a value from the cache, converts it to an int, and returns it.
+func (s *ShardedCache) GetInt(key string) (int, error) {
+	return GetInt(s, key)
+}
+
+// GetString is a convenience method which retrieves a value from the cache and returns it as a string.
+func (s *ShardedCache) GetString(key string) (string, error) {
+	return GetAs[string](s, key)
+}
+
+// GetTime retrieves a value from the cache by the specified key and returns it as time.Time.
+func (s *ShardedCache) GetTime(key string) (time.Time, error) {
+	return GetAs[time.Time](s, key)
+}
+
+// shardGroup is the keys of one operation which belong to one shard.
+type shardGroup struct {
+	cache CacheInterface
+	keys  []string
+}
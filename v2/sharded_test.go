@@ -0,0 +1,184 @@
+package remember
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestShardedCache returns a ShardedCache over n Redis caches, each with its own miniredis.
+func newTestShardedCache(t *testing.T, n int) (*ShardedCache, map[string]*miniredis.Miniredis) {
+	t.Helper()
+
+	servers := make(map[string]*miniredis.Miniredis, n)
+	shards := make(map[string]CacheInterface, n)
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("node%d", i)
+		servers[name] = miniredis.RunT(t)
+		shards[name] = newTestShard(t, servers[name])
+	}
+
+	cache := NewSharded(shards)
+	t.Cleanup(func() { _ = cache.Close() })
+	return cache, servers
+}
+
+// newTestShard returns a Redis cache using s.
+func newTestShard(t *testing.T, s *miniredis.Miniredis) CacheInterface {
+	t.Helper()
+
+	cache, err := NewRedis(WithAddr(s.Addr()), WithPrefix("sharded"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache
+}
+
+func TestShardedCache_Distribution(t *testing.T) {
+	cache, servers := newTestShardedCache(t, 3)
+
+	items := make(map[string]any)
+	for i := 0; i < 300; i++ {
+		items[fmt.Sprintf("key%d", i)] = i
+	}
+	err := cache.SetMany(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, s := range servers {
+		n := len(s.Keys())
+		if n < 60 || n > 140 {
+			t.Errorf("expected about 100 keys on %s, got %d", name, n)
+		}
+	}
+
+	for key := range items {
+		server := servers[cache.ShardFor(key)]
+		if !server.Exists("sharded:" + key) {
+			t.Errorf("expected %s on %s", key, cache.ShardFor(key))
+		}
+	}
+
+	values, err := cache.GetMany([]string{"key1", "key150", "key299", "missing"})
+	if err != nil {
+		t.Error(err)
+	}
+	if len(values) != 3 || values["key150"] != 150 {
+		t.Error("unexpected values from GetMany:", values)
+	}
+}
+
+func TestShardedCache_Remap(t *testing.T) {
+	cache, _ := newTestShardedCache(t, 3)
+
+	before := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		before[key] = cache.ShardFor(key)
+	}
+
+	err := cache.AddShard("node3", newTestShard(t, miniredis.RunT(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moved := 0
+	for key, old := range before {
+		if now := cache.ShardFor(key); now != old {
+			moved++
+			if now != "node3" {
+				t.Errorf("%s moved from %s to %s rather than to the new shard", key, old, now)
+			}
+		}
+	}
+	if moved < 150 || moved > 350 {
+		t.Error("expected about a quarter of the keys to move to the new shard, got", moved)
+	}
+
+	removed, err := cache.RemoveShard("node3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = removed.Close()
+
+	for key, old := range before {
+		if now := cache.ShardFor(key); now != old {
+			t.Errorf("%s did not return to %s after the new shard was removed", key, old)
+		}
+	}
+
+	if err := cache.AddShard("node0", nil); err == nil {
+		t.Error("expected error adding a duplicate shard")
+	}
+	if _, err := cache.RemoveShard("missing"); err == nil {
+		t.Error("expected error removing a missing shard")
+	}
+}
+
+func TestShardedCache_EmptyByMatch(t *testing.T) {
+	cache, servers := newTestShardedCache(t, 3)
+
+	items := make(map[string]any)
+	for i := 0; i < 30; i++ {
+		items[fmt.Sprintf("user:%d", i)] = i
+		items[fmt.Sprintf("post:%d", i)] = i
+	}
+	_ = cache.SetMany(items)
+
+	err := cache.EmptyByMatch("user:")
+	if err != nil {
+		t.Error(err)
+	}
+	for name, s := range servers {
+		for _, key := range s.Keys() {
+			if key[:len("sharded:user:")] == "sharded:user:" {
+				t.Errorf("%s still holds %s after EmptyByMatch", name, key)
+			}
+		}
+	}
+	if !cache.Has("post:7") {
+		t.Error("EmptyByMatch removed a key which did not match")
+	}
+
+	err = cache.Empty()
+	if err != nil {
+		t.Error(err)
+	}
+	for name, s := range servers {
+		if n := len(s.Keys()); n != 0 {
+			t.Errorf("expected %s to be empty, got %d keys", name, n)
+		}
+	}
+}
+
+func TestShardedCache_Operations(t *testing.T) {
+	cache, _ := newTestShardedCache(t, 2)
+
+	_ = cache.Set("foo", "bar")
+	if val, _ := cache.GetString("foo"); val != "bar" {
+		t.Error("expected bar, got", val)
+	}
+
+	n, err := cache.Increment("counter", 3)
+	if err != nil || n != 3 {
+		t.Error("expected 3, got", n, err)
+	}
+	if val, _ := cache.GetInt("counter"); val != 3 {
+		t.Error("expected counter of 3, got", val)
+	}
+
+	err = cache.ForgetMany([]string{"foo", "counter"})
+	if err != nil {
+		t.Error(err)
+	}
+	if cache.Has("foo") || cache.Has("counter") {
+		t.Error("ForgetMany did not remove keys")
+	}
+
+	empty := NewSharded(nil)
+	if err := empty.Set("foo", "bar"); err == nil {
+		t.Error("expected error using a sharded cache with no shards")
+	}
+}
@@ -0,0 +1,663 @@
+// Package sqlcache provides a remember cache stored in a table of a SQLite or PostgreSQL database,
+// through database/sql. Importing it registers the "sql" cache type with remember.New.
+package sqlcache
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/tsawler/remember/v2"
+	"golang.org/x/sync/singleflight"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// Cache is the type for a cache stored in a table of a relational database, through database/sql.
+// SQLite and PostgreSQL are supported. Expired rows are removed when they are read, and periodically
+// in the background. When Prefix is set, every key is stored as "prefix:key".
+type Cache struct {
+	Conn     *sql.DB
+	Table    string
+	Prefix   string
+	Codec    remember.Codec // The codec used to serialize values. Defaults to remember.GobCodec.
+	KeepOpen bool           // If true, Close leaves Conn open, for databases owned by the caller.
+	postgres bool
+	group    singleflight.Group
+	done     chan struct{}
+	closed   atomic.Bool
+}
+
+const (
+	// defaultTable is the table used when Options.SQLTable is not set.
+	defaultTable = "remember_cache"
+
+	// defaultPurgeInterval is used when Options.SQLPurgeInterval is not set.
+	defaultPurgeInterval = time.Minute
+
+	// batchSize limits the number of keys bound to a single statement.
+	batchSize = 500
+)
+
+// postgresDrivers are the database/sql driver names which use PostgreSQL's dialect.
+var postgresDrivers = map[string]bool{
+	"postgres":         true,
+	"pgx":              true,
+	"pgx/v5":           true,
+	"cloudsqlpostgres": true,
+}
+
+func init() {
+	_ = remember.Register("sql", func(ops *remember.Options) (remember.CacheInterface, error) {
+		cache, err := newCache(ops)
+		if err != nil {
+			return nil, err
+		}
+		return cache, nil
+	})
+}
+
+// New returns a SQL cache configured by opts, which must include WithDataSource.
+func New(opts ...remember.Option) (*Cache, error) {
+	ops := &remember.Options{}
+	for _, opt := range opts {
+		opt(ops)
+	}
+	return newCache(ops)
+}
+
+// WithDataSource sets the database/sql driver name and data source of the cache's database. The
+// driver must be imported by the program.
+func WithDataSource(driver, dataSource string) remember.Option {
+	return func(o *remember.Options) {
+		o.SQLDriver = driver
+		o.SQLDataSource = dataSource
+	}
+}
+
+// WithTable sets the table holding the cache.
+func WithTable(table string) remember.Option {
+	return func(o *remember.Options) { o.SQLTable = table }
+}
+
+// WithPurgeInterval sets how often the cache deletes expired rows.
+func WithPurgeInterval(interval time.Duration) remember.Option {
+	return func(o *remember.Options) { o.SQLPurgeInterval = interval }
+}
+
+// newCache validates ops and returns a SQL cache which owns its database.
+func newCache(o *remember.Options) (*Cache, error) {
+	ops := withDefaults(o)
+	if err := validate(ops); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(ops.SQLDriver, ops.SQLDataSource)
+	if err != nil {
+		return nil, err
+	}
+
+	cache, err := NewFromDB(db, ops)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	cache.KeepOpen = false
+	return cache, nil
+}
+
+// NewFromDB returns a cache which uses an existing database, creating the cache table if it does not
+// exist. SQLDriver in the options selects the SQL dialect, and Prefix, Codec, SQLTable and
+// SQLPurgeInterval are also honoured. Close leaves the database open unless KeepOpen is set to false.
+func NewFromDB(db *sql.DB, o ...*remember.Options) (*Cache, error) {
+	ops := &remember.Options{}
+	if len(o) > 0 && o[0] != nil {
+		ops = o[0]
+	}
+	ops = withDefaults(ops)
+	if !validIdentifier(ops.SQLTable) {
+		return nil, fmt.Errorf("%w: SQLTable %q is not a valid table name", remember.ErrInvalidOptions, ops.SQLTable)
+	}
+	if ops.SQLPurgeInterval < 0 {
+		return nil, fmt.Errorf("%w: SQLPurgeInterval must be positive", remember.ErrInvalidOptions)
+	}
+
+	c := &Cache{
+		Conn:     db,
+		Table:    ops.SQLTable,
+		Prefix:   ops.Prefix,
+		Codec:    ops.Codec,
+		KeepOpen: true,
+		postgres: postgresDrivers[ops.SQLDriver],
+		done:     make(chan struct{}),
+	}
+
+	if err := c.createTable(); err != nil {
+		return nil, err
+	}
+
+	go c.janitor(ops.SQLPurgeInterval)
+
+	return c, nil
+}
+
+// withDefaults returns a copy of o with a missing table or purge interval filled in.
+func withDefaults(o *remember.Options) *remember.Options {
+	ops := *o
+	if ops.SQLTable == "" {
+		ops.SQLTable = defaultTable
+	}
+	if ops.SQLPurgeInterval == 0 {
+		ops.SQLPurgeInterval = defaultPurgeInterval
+	}
+	return &ops
+}
+
+// validate reports every problem with ops as the configuration of a SQL cache. Each problem wraps
+// remember.ErrInvalidOptions.
+func validate(ops *remember.Options) error {
+	var problems []string
+	if ops.SQLDriver == "" {
+		problems = append(problems, "sql requires SQLDriver, such as sqlite3 or pgx")
+	}
+	if ops.SQLDataSource == "" {
+		problems = append(problems, "sql requires SQLDataSource")
+	}
+	if !validIdentifier(ops.SQLTable) {
+		problems = append(problems, fmt.Sprintf("SQLTable %q is not a valid table name", ops.SQLTable))
+	}
+	if ops.SQLPurgeInterval <= 0 {
+		problems = append(problems, "SQLPurgeInterval must be positive")
+	}
+
+	errs := make([]error, len(problems))
+	for i, problem := range problems {
+		errs[i] = fmt.Errorf("%w: %s", remember.ErrInvalidOptions, problem)
+	}
+	return errors.Join(errs...)
+}
+
+// createTable creates the cache table and its expiry index if they do not exist. Expiry is stored as
+// Unix nanoseconds, with NULL meaning the row never expires.
+func (c *Cache) createTable() error {
+	blob := "BLOB"
+	if c.postgres {
+		blob = "BYTEA"
+	}
+
+	statements := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	cache_key VARCHAR(1024) NOT NULL PRIMARY KEY,
+	value %s NOT NULL,
+	expires_at BIGINT
+)`, c.Table, blob),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_expires_at ON %s (expires_at)", c.Table, c.Table),
+	}
+
+	for _, stmt := range statements {
+		if _, err := c.Conn.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// janitor deletes expired rows every interval until the cache is closed.
+func (c *Cache) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			_ = c.Purge()
+		}
+	}
+}
+
+// Purge deletes every expired row from the cache table, whichever prefix it belongs to. It is called
+// periodically, so there is normally no need to call it directly.
+func (c *Cache) Purge() error {
+	if c.closed.Load() {
+		return remember.ErrClosed
+	}
+
+	_, err := c.Conn.Exec(c.query("DELETE FROM %s WHERE expires_at <= ?"), time.Now().UnixNano())
+	return err
+}
+
+// Close stops the background purge and closes the database, unless KeepOpen is set. Any later
+// operation returns remember.ErrClosed.
+func (c *Cache) Close() error {
+	if !c.closed.CompareAndSwap(false, true) {
+		return remember.ErrClosed
+	}
+	close(c.done)
+
+	if c.KeepOpen {
+		return nil
+	}
+	return c.Conn.Close()
+}
+
+// Has checks to see if the supplied key is in the cache and returns true if found, otherwise false.
+func (c *Cache) Has(key string) bool {
+	_, err := c.Get(key)
+	return err == nil
+}
+
+// Get attempts to retrieve a value from the cache. An expired row is deleted, and reported as
+// remember.ErrExpired.
+func (c *Cache) Get(key string) (any, error) {
+	data, _, err := c.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	return remember.DecodeValue(data)
+}
+
+// Set puts a value into the cache. The final parameter, expires, is optional.
+func (c *Cache) Set(key string, value any, expires ...time.Duration) error {
+	return c.SetMany(map[string]any{key: value}, expires...)
+}
+
+// Remember returns the value stored at key. If the key is not in the cache, fn is called to compute
+// the value, which is stored with the given ttl (0 means no expiry) and returned. Concurrent misses
+// for the same key share a single call to fn.
+func (c *Cache) Remember(key string, ttl time.Duration, fn func() (any, error)) (any, error) {
+	return remember.Remember(c, &c.group, key, ttl, fn)
+}
+
+// Forget removes an item from the cache, by key.
+func (c *Cache) Forget(key string) error {
+	return c.ForgetMany([]string{key})
+}
+
+// GetMany retrieves several values from the cache, with one query per 500 keys. Keys which are not in
+// the cache are omitted from the returned map.
+func (c *Cache) GetMany(keys []string) (map[string]any, error) {
+	if c.closed.Load() {
+		return nil, remember.ErrClosed
+	}
+
+	result := make(map[string]any, len(keys))
+	now := time.Now().UnixNano()
+
+	for start := 0; start < len(keys); start += batchSize {
+		batch := keys[start:min(start+batchSize, len(keys))]
+
+		args := make([]any, 0, len(batch)+1)
+		byStored := make(map[string]string, len(batch))
+		for _, key := range batch {
+			args = append(args, c.key(key))
+			byStored[c.key(key)] = key
+		}
+		args = append(args, now)
+
+		rows, err := c.Conn.Query(c.query("SELECT cache_key, value FROM %s WHERE cache_key IN ("+
+			placeholders(len(batch))+") AND (expires_at IS NULL OR expires_at > ?)"), args...)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var stored string
+			var data []byte
+			if err := rows.Scan(&stored, &data); err != nil {
+				_ = rows.Close()
+				return nil, err
+			}
+
+			val, err := remember.DecodeValue(data)
+			if err != nil {
+				_ = rows.Close()
+				return nil, err
+			}
+			result[byStored[stored]] = val
+		}
+		if err := rows.Close(); err != nil {
+			return nil, err
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// SetMany puts several values into the cache, in a single transaction. The final parameter, expires,
+// is optional, and applies to every item.
+func (c *Cache) SetMany(items map[string]any, expires ...time.Duration) error {
+	if c.closed.Load() {
+		return remember.ErrClosed
+	}
+
+	var expiresAt any
+	if len(expires) > 0 && expires[0] > 0 {
+		expiresAt = time.Now().Add(expires[0]).UnixNano()
+	}
+
+	tx, err := c.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := tx.Prepare(c.query(`INSERT INTO %s (cache_key, value, expires_at) VALUES (?, ?, ?)
+ON CONFLICT (cache_key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at`))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for key, value := range items {
+		data, err := remember.EncodeValue(c.Codec, value)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.Exec(c.key(key), data, expiresAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ForgetMany removes several items from the cache, with one statement per 500 keys.
+func (c *Cache) ForgetMany(keys []string) error {
+	if c.closed.Load() {
+		return remember.ErrClosed
+	}
+
+	for start := 0; start < len(keys); start += batchSize {
+		batch := keys[start:min(start+batchSize, len(keys))]
+
+		args := make([]any, len(batch))
+		for i, key := range batch {
+			args[i] = c.key(key)
+		}
+
+		_, err := c.Conn.Exec(c.query("DELETE FROM %s WHERE cache_key IN ("+placeholders(len(batch))+")"), args...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EmptyByMatch removes all entries in the cache which have the prefix match, with a single DELETE
+// using LIKE. The extra comparison of the key's leading characters makes the match case-sensitive
+// on SQLite, whose LIKE ignores case.
+func (c *Cache) EmptyByMatch(match string) error {
+	if c.closed.Load() {
+		return remember.ErrClosed
+	}
+
+	prefix := c.key(match)
+	if prefix == "" {
+		_, err := c.Conn.Exec(c.query("DELETE FROM %s"))
+		return err
+	}
+
+	_, err := c.Conn.Exec(c.query(`DELETE FROM %s WHERE cache_key LIKE ? ESCAPE '\' AND substr(cache_key, 1, ?) = ?`),
+		escapeLike(prefix)+"%", utf8.RuneCountInString(prefix), prefix)
+	return err
+}
+
+// Empty removes all entries in the cache. When Prefix is set, only this client's entries are removed.
+func (c *Cache) Empty() error {
+	return c.EmptyByMatch("")
+}
+
+// GetCtx attempts to retrieve a value from the cache, returning ctx.Err() if ctx is already done.
+func (c *Cache) GetCtx(ctx context.Context, key string) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.Get(key)
+}
+
+// HasCtx checks for existence of item in cache, returning false if ctx is already done.
+func (c *Cache) HasCtx(ctx context.Context, key string) bool {
+	return ctx.Err() == nil && c.Has(key)
+}
+
+// SetCtx puts a value into the cache, returning ctx.Err() if ctx is already done. The final
+// parameter, expires, is optional.
+func (c *Cache) SetCtx(ctx context.Context, key string, value any, expires ...time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Set(key, value, expires...)
+}
+
+// ForgetCtx removes an item from the cache, by key, returning ctx.Err() if ctx is already done.
+func (c *Cache) ForgetCtx(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Forget(key)
+}
+
+// EmptyByMatchCtx removes all entries in the cache which have the prefix match, returning ctx.Err()
+// if ctx is already done.
+func (c *Cache) EmptyByMatchCtx(ctx context.Context, match string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.EmptyByMatch(match)
+}
+
+// EmptyCtx removes all entries from the cache, returning ctx.Err() if ctx is already done.
+func (c *Cache) EmptyCtx(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Empty()
+}
+
+// Increment atomically adds delta to the int64 counter stored at key, and returns the new value. A
+// missing key is treated as 0. The optional ttl is applied only when the counter is created; an
+// existing counter keeps its expiry. The counter is updated with a compare-and-swap, which is retried
+// if another writer changes it first.
+func (c *Cache) Increment(key string, delta int64, ttl ...time.Duration) (int64, error) {
+	if c.closed.Load() {
+		return 0, remember.ErrClosed
+	}
+
+	for {
+		// The expiry is worked out afresh on each pass, and the row is read back without checking it,
+		// so that a counter whose TTL runs out before it can be read is still incremented once rather
+		// than being recreated forever.
+		now := time.Now()
+		var expiresAt any
+		if t := remember.CounterTTL(ttl); t > 0 {
+			expiresAt = now.Add(t).UnixNano()
+		}
+
+		_, err := c.Conn.Exec(c.query("DELETE FROM %s WHERE cache_key = ? AND expires_at <= ?"), c.key(key), now.UnixNano())
+		if err != nil {
+			return 0, err
+		}
+		_, err = c.Conn.Exec(c.query("INSERT INTO %s (cache_key, value, expires_at) VALUES (?, ?, ?) ON CONFLICT (cache_key) DO NOTHING"),
+			c.key(key), remember.FormatCounter(0), expiresAt)
+		if err != nil {
+			return 0, err
+		}
+
+		var data []byte
+		err = c.Conn.QueryRow(c.query("SELECT value FROM %s WHERE cache_key = ?"), c.key(key)).Scan(&data)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		n, err := remember.ParseCounter(key, data)
+		if err != nil {
+			return 0, err
+		}
+		n += delta
+
+		res, err := c.Conn.Exec(c.query("UPDATE %s SET value = ? WHERE cache_key = ? AND value = ?"), remember.FormatCounter(n), c.key(key), data)
+		if err != nil {
+			return 0, err
+		}
+		if updated, err := res.RowsAffected(); err != nil {
+			return 0, err
+		} else if updated == 1 {
+			return n, nil
+		}
+	}
+}
+
+// Decrement atomically subtracts delta from the counter stored at key, and returns the new value. See
+// Increment.
+func (c *Cache) Decrement(key string, delta int64, ttl ...time.Duration) (int64, error) {
+	return c.Increment(key, -delta, ttl...)
+}
+
+// TTL returns the time remaining before key expires, or remember.NoExpiration if it never expires.
+func (c *Cache) TTL(key string) (time.Duration, error) {
+	_, expiresAt, err := c.lookup(key)
+	if err != nil {
+		return 0, err
+	}
+	if !expiresAt.Valid {
+		return remember.NoExpiration, nil
+	}
+	return time.Until(time.Unix(0, expiresAt.Int64)), nil
+}
+
+// Touch sets the time remaining before key expires to ttl.
+func (c *Cache) Touch(key string, ttl time.Duration) error {
+	return c.setExpiry(key, time.Now().Add(ttl).UnixNano())
+}
+
+// Persist removes the expiry from key, so that it never expires.
+func (c *Cache) Persist(key string) error {
+	return c.setExpiry(key, nil)
+}
+
+// setExpiry changes the expiry of the live row stored at key. A nil expiry means the row never
+// expires.
+func (c *Cache) setExpiry(key string, expiresAt any) error {
+	if c.closed.Load() {
+		return remember.ErrClosed
+	}
+
+	res, err := c.Conn.Exec(c.query("UPDATE %s SET expires_at = ? WHERE cache_key = ? AND (expires_at IS NULL OR expires_at > ?)"),
+		expiresAt, c.key(key), time.Now().UnixNano())
+	if err != nil {
+		return err
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return remember.ErrNotFound
+	}
+	return nil
+}
+
+// GetInt is a convenience method which retrieves a value from the cache, converts it to an int, and returns it.
+func (c *Cache) GetInt(key string) (int, error) {
+	return remember.GetInt(c, key)
+}
+
+// GetString is a convenience method which retrieves a value from the cache and returns it as a string.
+func (c *Cache) GetString(key string) (string, error) {
+	return remember.GetAs[string](c, key)
+}
+
+// GetTime retrieves a value from the cache by the specified key and returns it as time.Time.
+func (c *Cache) GetTime(key string) (time.Time, error) {
+	return remember.GetAs[time.Time](c, key)
+}
+
+// lookup returns the stored value and expiry of the live row at key. An expired row is deleted and
+// reported as remember.ErrExpired.
+func (c *Cache) lookup(key string) ([]byte, sql.NullInt64, error) {
+	var data []byte
+	var expiresAt sql.NullInt64
+
+	if c.closed.Load() {
+		return nil, expiresAt, remember.ErrClosed
+	}
+
+	err := c.Conn.QueryRow(c.query("SELECT value, expires_at FROM %s WHERE cache_key = ?"), c.key(key)).Scan(&data, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, expiresAt, remember.ErrNotFound
+	}
+	if err != nil {
+		return nil, expiresAt, err
+	}
+
+	if now := time.Now().UnixNano(); expiresAt.Valid && expiresAt.Int64 <= now {
+		_, _ = c.Conn.Exec(c.query("DELETE FROM %s WHERE cache_key = ? AND expires_at <= ?"), c.key(key), now)
+		return nil, expiresAt, remember.ErrExpired
+	}
+	return data, expiresAt, nil
+}
+
+// key returns the key as stored in the table.
+func (c *Cache) key(str string) string {
+	if c.Prefix == "" {
+		return str
+	}
+	return fmt.Sprintf("%s:%s", c.Prefix, str)
+}
+
+// query puts the table name into stmt, and rewrites its ? placeholders as $1, $2 and so on for
+// PostgreSQL.
+func (c *Cache) query(stmt string) string {
+	stmt = fmt.Sprintf(stmt, c.Table)
+	if !c.postgres {
+		return stmt
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range stmt {
+		if r == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// placeholders returns n comma-separated ? placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// escapeLike escapes the LIKE wildcards in s, using backslash as the escape character.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// validIdentifier reports whether name can be used as a table name without quoting.
+func validIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
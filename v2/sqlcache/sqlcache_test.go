@@ -0,0 +1,188 @@
+package sqlcache
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/tsawler/remember/v2"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestCache returns a Cache stored in a temporary SQLite database.
+func newTestCache(t *testing.T, opts ...remember.Option) *Cache {
+	t.Helper()
+
+	dsn := filepath.Join(t.TempDir(), "cache.db")
+	cache, err := New(append([]remember.Option{WithDataSource("sqlite3", dsn), remember.WithPrefix("test")}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = cache.Close() })
+	return cache
+}
+
+func TestNew(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "cache.db")
+	cache, err := remember.New("sql", &remember.Options{SQLDriver: "sqlite3", SQLDataSource: dsn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	_, err = remember.New("sql", &remember.Options{SQLDriver: "sqlite3"})
+	if !errors.Is(err, remember.ErrInvalidOptions) {
+		t.Error("expected ErrInvalidOptions without a data source, got", err)
+	}
+}
+
+func TestCache_Purge(t *testing.T) {
+	cache := newTestCache(t, WithPurgeInterval(20*time.Millisecond))
+
+	_ = cache.Set("lazy", "value", 10*time.Millisecond)
+	_ = cache.Set("purged", "value", 10*time.Millisecond)
+	_ = cache.Set("kept", "value")
+	time.Sleep(15 * time.Millisecond)
+
+	_, err := cache.Get("lazy")
+	if !errors.Is(err, remember.ErrExpired) {
+		t.Error("expected ErrExpired, got", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	var rows int
+	err = cache.Conn.QueryRow("SELECT COUNT(*) FROM remember_cache").Scan(&rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows != 1 {
+		t.Error("expected expired rows to be purged, leaving 1, got", rows)
+	}
+}
+
+func TestCache_EmptyByMatch(t *testing.T) {
+	cache := newTestCache(t)
+	other, err := NewFromDB(cache.Conn, &remember.Options{Prefix: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	_ = cache.SetMany(map[string]any{"user:1": "a", "User:2": "b", "user_3": "c", "user%4": "d", "post:1": "e"})
+	_ = other.Set("user:1", "untouched")
+
+	tests := []struct {
+		match   string
+		removed []string
+		kept    []string
+	}{
+		{"user%", []string{"user%4"}, []string{"user:1", "User:2", "user_3"}},
+		{"user:", []string{"user:1"}, []string{"User:2", "user_3"}},
+		{"", []string{"User:2", "user_3", "post:1"}, nil},
+	}
+
+	for _, tt := range tests {
+		err := cache.EmptyByMatch(tt.match)
+		if err != nil {
+			t.Error(err)
+		}
+		for _, key := range tt.removed {
+			if cache.Has(key) {
+				t.Errorf("EmptyByMatch(%q) did not remove %q", tt.match, key)
+			}
+		}
+		for _, key := range tt.kept {
+			if !cache.Has(key) {
+				t.Errorf("EmptyByMatch(%q) removed %q", tt.match, key)
+			}
+		}
+	}
+
+	if !other.Has("user:1") {
+		t.Error("Empty removed a key belonging to another prefix")
+	}
+}
+
+func TestCache_Many(t *testing.T) {
+	cache := newTestCache(t)
+
+	items := make(map[string]any)
+	keys := make([]string, 0, 600)
+	for i := 0; i < 600; i++ {
+		key := fmt.Sprintf("key%d", i)
+		items[key] = i
+		keys = append(keys, key)
+	}
+
+	err := cache.SetMany(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := cache.GetMany(append(keys, "missing"))
+	if err != nil {
+		t.Error(err)
+	}
+	if len(values) != 600 || values[keys[550]] != 550 {
+		t.Error("unexpected values from GetMany across batches:", len(values))
+	}
+
+	err = cache.ForgetMany(keys)
+	if err != nil {
+		t.Error(err)
+	}
+	values, _ = cache.GetMany(keys)
+	if len(values) != 0 {
+		t.Error("expected no values after ForgetMany, got", len(values))
+	}
+}
+
+func TestCache_Close(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	cache, err := NewFromDB(db, &remember.Options{SQLDriver: "sqlite3", SQLTable: "borrowed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cache.Close()
+	if err != nil {
+		t.Error(err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Error("expected borrowed database to be left open:", err)
+	}
+	if err := cache.Set("foo", "bar"); !errors.Is(err, remember.ErrClosed) {
+		t.Error("expected ErrClosed, got", err)
+	}
+}
+
+func TestCache_Query(t *testing.T) {
+	tests := []struct {
+		name     string
+		postgres bool
+		expected string
+	}{
+		{"sqlite", false, "SELECT value FROM cache WHERE cache_key IN (?, ?) AND expires_at > ?"},
+		{"postgres", true, "SELECT value FROM cache WHERE cache_key IN ($1, $2) AND expires_at > $3"},
+	}
+
+	for _, tt := range tests {
+		c := &Cache{Table: "cache", postgres: tt.postgres}
+		if q := c.query("SELECT value FROM %s WHERE cache_key IN (" + placeholders(2) + ") AND expires_at > ?"); q != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, q)
+		}
+	}
+
+	_, err := New(WithDataSource("sqlite3", ":memory:"), WithTable("cache; DROP TABLE users"))
+	if !errors.Is(err, remember.ErrInvalidOptions) {
+		t.Error("expected ErrInvalidOptions for an invalid table name, got", err)
+	}
+}
@@ -0,0 +1,306 @@
+package remember
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/redis/go-redis/v9"
+	"github.com/tidwall/buntdb"
+)
+
+// tagMarker starts the keys which record tag membership, under the cache's prefix, so that Empty
+// removes them along with the entries.
+const tagMarker = "__tag:"
+
+// Tagger is implemented by caches which can group entries under tags, so that everything related to,
+// say, one user can be removed at once, whatever the entries' keys.
+type Tagger interface {
+	// Tags returns a TaggedCache which writes entries under all of tags.
+	Tags(tags ...string) *TaggedCache
+
+	// FlushTags removes every entry written under any of tags.
+	FlushTags(tags ...string) error
+}
+
+// tagStore is implemented by the backends which support tags.
+type tagStore interface {
+	setTagged(tags []string, items map[string]any, expiration time.Duration) error
+	FlushTags(tags ...string) error
+}
+
+// TaggedCache writes entries under a set of tags. Entries are read as usual, from the cache which
+// returned it. Tag membership expires along with the entries.
+type TaggedCache struct {
+	store tagStore
+	tags  []string
+}
+
+// Set puts a value into the cache under the TaggedCache's tags. The final parameter, expires, is
+// optional.
+func (t *TaggedCache) Set(key string, value any, expires ...time.Duration) error {
+	return t.SetMany(map[string]any{key: value}, expires...)
+}
+
+// SetMany puts several values into the cache under the TaggedCache's tags. The final parameter,
+// expires, is optional, and applies to every item.
+func (t *TaggedCache) SetMany(items map[string]any, expires ...time.Duration) error {
+	if err := validateTags(t.tags); err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	var expiration time.Duration
+	if len(expires) > 0 {
+		expiration = expires[0]
+	}
+	return t.store.setTagged(t.tags, items, expiration)
+}
+
+// Flush removes every entry written under any of the TaggedCache's tags.
+func (t *TaggedCache) Flush() error {
+	return t.store.FlushTags(t.tags...)
+}
+
+// validateTags rejects tags which are empty or contain a colon, since a colon would make one tag's
+// index keys look like another's.
+func validateTags(tags []string) error {
+	if len(tags) == 0 {
+		return fmt.Errorf("%w: at least one tag is required", ErrInvalidOptions)
+	}
+	for _, tag := range tags {
+		if tag == "" || strings.Contains(tag, ":") {
+			return fmt.Errorf("%w: invalid tag %q", ErrInvalidOptions, tag)
+		}
+	}
+	return nil
+}
+
+// tagIndexKey returns the unprefixed key which records that key has tag.
+func tagIndexKey(tag, key string) string {
+	return tagMarker + tag + ":" + key
+}
+
+// tagScript adds members to the sorted set of a tag, scored by the time they expire in Unix
+// milliseconds (0 means never), drops members which have already expired, and sets the set to expire
+// with its last member. ARGV is the members' TTL in milliseconds (0 means none) followed by the
+// members. Times are taken from the server's clock, which also governs the members' own expiry.
+var tagScript = redis.NewScript(`
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local score = 0
+if ARGV[1] ~= '0' then
+	score = now + tonumber(ARGV[1])
+end
+for i = 2, #ARGV do
+	redis.call('ZADD', KEYS[1], score, ARGV[i])
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '(0', now)
+if redis.call('ZCOUNT', KEYS[1], 0, 0) > 0 then
+	return redis.call('PERSIST', KEYS[1])
+end
+local last = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+if #last == 0 then
+	return 0
+end
+return redis.call('PEXPIREAT', KEYS[1], last[2])
+`)
+
+// Tags returns a TaggedCache which writes entries under all of tags. Each tag is a sorted set in
+// Redis, holding the keys written under it.
+func (c *RedisCache) Tags(tags ...string) *TaggedCache {
+	return &TaggedCache{store: c, tags: tags}
+}
+
+// setTagged writes items, and adds them to the set of each tag, in a single pipeline.
+func (c *RedisCache) setTagged(tags []string, items map[string]any, expiration time.Duration) error {
+	ctx := context.Background()
+
+	args := []any{expiration.Milliseconds()}
+	encoded := make(map[string][]byte, len(items))
+	keys := make([]string, 0, len(items))
+	for key, data := range items {
+		b, err := EncodeValue(c.Codec, data)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", key, err)
+		}
+		encoded[key] = b
+		keys = append(keys, key)
+		args = append(args, key)
+	}
+
+	_, err := c.Conn.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, tag := range tags {
+			tagScript.Eval(ctx, pipe, []string{c.key(tagMarker + tag)}, args...)
+		}
+		for key, b := range encoded {
+			pipe.Set(ctx, c.key(key), b, expiration)
+		}
+		return nil
+	})
+	if err != nil {
+		return wrapError(err)
+	}
+
+	return c.publish(ctx, Invalidation{Keys: keys})
+}
+
+// FlushTags removes every entry written under any of tags, along with the tags' sets.
+func (c *RedisCache) FlushTags(tags ...string) error {
+	if err := validateTags(tags); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	members := make([]*redis.StringSliceCmd, len(tags))
+	_, err := c.Conn.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, tag := range tags {
+			members[i] = pipe.ZRange(ctx, c.key(tagMarker+tag), 0, -1)
+		}
+		return nil
+	})
+	if err != nil {
+		return wrapError(err)
+	}
+
+	var keys []string
+	for i, tag := range tags {
+		keys = append(keys, members[i].Val()...)
+		keys = append(keys, tagMarker+tag)
+	}
+	return c.ForgetMany(keys)
+}
+
+// Tags returns a TaggedCache which writes entries under all of tags. Each tagged entry has an index
+// key per tag, with the same expiry as the entry.
+func (b *BadgerCache) Tags(tags ...string) *TaggedCache {
+	return &TaggedCache{store: b, tags: tags}
+}
+
+// setTagged writes items and their index keys in a single transaction.
+func (b *BadgerCache) setTagged(tags []string, items map[string]any, expiration time.Duration) error {
+	var expiresAt uint64
+	if expiration > 0 {
+		expiresAt = uint64(time.Now().Add(expiration).Unix())
+	}
+
+	entries := make([]*badger.Entry, 0, len(items)*(len(tags)+1))
+	for key, value := range items {
+		encoded, err := EncodeValue(b.Codec, value)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", key, err)
+		}
+
+		entries = append(entries, &badger.Entry{Key: b.key(key), Value: encoded, ExpiresAt: expiresAt})
+		for _, tag := range tags {
+			entries = append(entries, &badger.Entry{Key: b.key(tagIndexKey(tag, key)), ExpiresAt: expiresAt})
+		}
+	}
+
+	err := b.Conn.Update(func(txn *badger.Txn) error {
+		for _, e := range entries {
+			if err := txn.SetEntry(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return wrapError(err)
+}
+
+// FlushTags removes every entry written under any of tags, along with their index keys. Large tags
+// are removed in several transactions.
+func (b *BadgerCache) FlushTags(tags ...string) error {
+	if err := validateTags(tags); err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		index := b.key(tagIndexKey(tag, ""))
+		err := b.deleteMatching(context.Background(), index, func(key []byte) [][]byte {
+			return [][]byte{b.key(string(key[len(index):]))}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tags returns a TaggedCache which writes entries under all of tags. Each tagged entry has an index
+// key per tag, with the same expiry as the entry.
+func (b *BuntDBCache) Tags(tags ...string) *TaggedCache {
+	return &TaggedCache{store: b, tags: tags}
+}
+
+// setTagged writes items and their index keys in a single transaction.
+func (b *BuntDBCache) setTagged(tags []string, items map[string]any, expiration time.Duration) error {
+	encoded := make(map[string]string, len(items))
+	for key, value := range items {
+		data, err := EncodeValue(b.Codec, value)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", key, err)
+		}
+		encoded[key] = string(data)
+	}
+
+	var so *buntdb.SetOptions
+	if expiration > 0 {
+		so = &buntdb.SetOptions{Expires: true, TTL: expiration}
+	}
+
+	err := b.Conn.Update(func(tx *buntdb.Tx) error {
+		for key, val := range encoded {
+			if _, _, err := tx.Set(b.key(key), val, so); err != nil {
+				return err
+			}
+			for _, tag := range tags {
+				if _, _, err := tx.Set(b.key(tagIndexKey(tag, key)), "", so); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+
+	return wrapError(err)
+}
+
+// FlushTags removes every entry written under any of tags, along with their index keys, in a single
+// transaction.
+func (b *BuntDBCache) FlushTags(tags ...string) error {
+	if err := validateTags(tags); err != nil {
+		return err
+	}
+
+	err := b.Conn.Update(func(tx *buntdb.Tx) error {
+		var keys []string
+		for _, tag := range tags {
+			index := b.key(tagIndexKey(tag, ""))
+			err := tx.AscendGreaterOrEqual("", index, func(key, value string) bool {
+				if !strings.HasPrefix(key, index) {
+					return false
+				}
+				keys = append(keys, key, b.key(key[len(index):]))
+				return true
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, key := range keys {
+			if _, err := tx.Delete(key); err != nil && err != buntdb.ErrNotFound {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return wrapError(err)
+}
@@ -0,0 +1,131 @@
+package remember
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTags(t *testing.T) {
+	backends, _ := newTestBackends(t)
+
+	for _, tt := range backends {
+		tagger := tt.cache.(Tagger)
+
+		if err := tagger.Tags("user42").Set("profile:42", "alice"); err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		err := tagger.Tags("user42", "posts").SetMany(map[string]any{"post:1": "hello", "post:2": "world"}, time.Hour)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if err := tagger.Tags("posts").Set("post:3", "other"); err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if err := tt.cache.Set("untagged", "value"); err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+
+		if val, _ := tt.cache.GetString("post:1"); val != "hello" {
+			t.Errorf("%s: expected hello, got %s", tt.name, val)
+		}
+
+		err = tagger.FlushTags("user42")
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		}
+		for _, key := range []string{"profile:42", "post:1", "post:2"} {
+			if tt.cache.Has(key) {
+				t.Errorf("%s: %s was not removed with its tag", tt.name, key)
+			}
+		}
+		if !tt.cache.Has("post:3") || !tt.cache.Has("untagged") {
+			t.Errorf("%s: FlushTags removed an entry without the tag", tt.name)
+		}
+
+		err = tagger.Tags("posts").Flush()
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		}
+		if tt.cache.Has("post:3") {
+			t.Errorf("%s: post:3 was not removed by Flush", tt.name)
+		}
+
+		if err := tagger.Tags("posts").SetMany(map[string]any{}, time.Hour); err != nil {
+			t.Errorf("%s: expected SetMany with no items to do nothing, got %v", tt.name, err)
+		}
+
+		err = tagger.Tags("a:b").Set("foo", "bar")
+		if !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("%s: expected ErrInvalidOptions for a tag containing a colon, got %v", tt.name, err)
+		}
+		if err := tagger.FlushTags(); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("%s: expected ErrInvalidOptions with no tags, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestTags_FlushLarge(t *testing.T) {
+	backends, _ := newTestBackends(t)
+
+	for _, tt := range backends {
+		items := make(map[string]any)
+		for i := 0; i < 2000; i++ {
+			items[fmt.Sprintf("item%d", i)] = i
+		}
+		if err := tt.cache.(Tagger).Tags("bulk").SetMany(items); err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+
+		if err := tt.cache.(Tagger).FlushTags("bulk"); err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		}
+		values, _ := tt.cache.GetMany([]string{"item0", "item999", "item1999"})
+		if len(values) != 0 {
+			t.Errorf("%s: expected every tagged entry to be removed, got %v", tt.name, values)
+		}
+	}
+}
+
+func TestRedisCache_TagExpiry(t *testing.T) {
+	backends, s := newTestBackends(t)
+	cache := backends[0].cache.(*RedisCache)
+	tagKey := "test_cache:__tag:session"
+
+	if err := cache.Tags("session").Set("a", 1, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Tags("session").Set("b", 2, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := s.TTL(tagKey); ttl < 59*time.Minute || ttl > time.Hour {
+		t.Error("expected the tag to expire with its last member, got", ttl)
+	}
+
+	// Expired members are dropped the next time the tag is written.
+	s.SetTime(time.Now().Add(2 * time.Minute))
+	s.FastForward(2 * time.Minute)
+	if err := cache.Tags("session").Set("c", 3, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	members, _ := s.ZMembers(tagKey)
+	if len(members) != 2 {
+		t.Error("expected the expired member to be dropped, got", members)
+	}
+
+	if err := cache.Tags("session").Set("d", 4); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := s.TTL(tagKey); ttl != 0 {
+		t.Error("expected the tag not to expire while it has a member which does not, got", ttl)
+	}
+
+	if err := cache.Tags("other").Set("e", 5, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	s.FastForward(2 * time.Second)
+	if s.Exists("test_cache:__tag:other") {
+		t.Error("expected the tag to expire along with its only member")
+	}
+}
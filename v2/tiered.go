@@ -0,0 +1,230 @@
+package remember
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// defaultL1TTL is how long a TieredCache keeps values in its in-process tier when no L1TTL is given.
+const defaultL1TTL = time.Minute
+
+// TieredCache layers an in-process MemoryCache (L1) in front of any other cache (L2), such as a
+// RedisCache. Reads are served from L1 when possible; misses are read through from L2 and copied into
+// L1 for at most L1TTL, or the time the value has left in L2 if that is shorter. Writes and removals go to L2 first and then to L1, so the two tiers stay
+// consistent within a process. Other processes writing to L2 are not seen until the L1 copy expires,
+// so L1TTL bounds how stale a read can be.
+type TieredCache struct {
+	L1    *MemoryCache
+	L2    CacheInterface
+	L1TTL time.Duration
+	group singleflight.Group
+}
+
+// NewTiered returns a TieredCache which keeps values in l1 for at most l1TTL, or one minute if l1TTL
+// is zero, in front of l2.
+func NewTiered(l1 *MemoryCache, l2 CacheInterface, l1TTL time.Duration) *TieredCache {
+	if l1TTL <= 0 {
+		l1TTL = defaultL1TTL
+	}
+
+	return &TieredCache{
+		L1:    l1,
+		L2:    l2,
+		L1TTL: l1TTL,
+	}
+}
+
+// l1Expiry returns how long a value which expires in L2 after the optional duration should be kept
+// in L1.
+func (t *TieredCache) l1Expiry(expires []time.Duration) time.Duration {
+	if len(expires) > 0 && expires[0] > 0 && expires[0] < t.L1TTL {
+		return expires[0]
+	}
+	return t.L1TTL
+}
+
+// copyToL1 copies a value read from L2 into L1, for at most L1TTL and no longer than it has left in
+// L2. Nothing is copied if the value has no time left, or its expiry cannot be read.
+func (t *TieredCache) copyToL1(key string, val any) {
+	ttl := t.L1TTL
+	remaining, err := t.L2.TTL(key)
+	switch {
+	case err != nil:
+		return
+	case remaining == NoExpiration:
+	case remaining <= 0:
+		return
+	case remaining < ttl:
+		ttl = remaining
+	}
+
+	_ = t.L1.Set(key, val, ttl)
+}
+
+// Has checks to see if the supplied key is in either tier.
+func (t *TieredCache) Has(key string) bool {
+	return t.L1.Has(key) || t.L2.Has(key)
+}
+
+// Close closes both tiers.
+func (t *TieredCache) Close() error {
+	return errors.Join(t.L1.Close(), t.L2.Close())
+}
+
+// Get retrieves a value from L1 or, failing that, from L2, in which case it is copied into L1 for no
+// longer than it has left in L2.
+func (t *TieredCache) Get(key string) (any, error) {
+	if val, err := t.L1.Get(key); err == nil {
+		return val, nil
+	}
+
+	val, err := t.L2.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	t.copyToL1(key, val)
+	return val, nil
+}
+
+// Set puts a value into L2 and then L1. The final parameter, expires, is optional.
+func (t *TieredCache) Set(key string, data any, expires ...time.Duration) error {
+	if err := t.L2.Set(key, data, expires...); err != nil {
+		return err
+	}
+	return t.L1.Set(key, data, t.l1Expiry(expires))
+}
+
+// Remember returns the value stored at key in either tier. If the key is in neither, fn is called to
+// compute the value, which is stored in both tiers with the given ttl (0 means no expiry) and returned.
+// Concurrent misses for the same key within this process share a single call to fn.
+func (t *TieredCache) Remember(key string, ttl time.Duration, fn func() (any, error)) (any, error) {
+	return Remember(t, &t.group, key, ttl, fn)
+}
+
+// Forget removes an item from both tiers.
+func (t *TieredCache) Forget(key string) error {
+	if err := t.L2.Forget(key); err != nil {
+		return err
+	}
+	return t.L1.Forget(key)
+}
+
+// GetMany retrieves several values, reading only those missing from L1 from L2. Keys which are in
+// neither tier are omitted from the returned map.
+func (t *TieredCache) GetMany(keys []string) (map[string]any, error) {
+	result, err := t.L1.GetMany(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, key := range keys {
+		if _, ok := result[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	fromL2, err := t.L2.GetMany(missing)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, val := range fromL2 {
+		result[key] = val
+		t.copyToL1(key, val)
+	}
+	return result, nil
+}
+
+// SetMany puts several values into L2 and then L1. The final parameter, expires, is optional, and
+// applies to every item.
+func (t *TieredCache) SetMany(items map[string]any, expires ...time.Duration) error {
+	if err := t.L2.SetMany(items, expires...); err != nil {
+		return err
+	}
+	return t.L1.SetMany(items, t.l1Expiry(expires))
+}
+
+// ForgetMany removes several items from both tiers.
+func (t *TieredCache) ForgetMany(keys []string) error {
+	if err := t.L2.ForgetMany(keys); err != nil {
+		return err
+	}
+	return t.L1.ForgetMany(keys)
+}
+
+// EmptyByMatch removes all entries which have the prefix match from both tiers.
+func (t *TieredCache) EmptyByMatch(match string) error {
+	if err := t.L2.EmptyByMatch(match); err != nil {
+		return err
+	}
+	return t.L1.EmptyByMatch(match)
+}
+
+// Empty removes all entries from both tiers.
+func (t *TieredCache) Empty() error {
+	if err := t.L2.Empty(); err != nil {
+		return err
+	}
+	return t.L1.Empty()
+}
+
+// Increment atomically adds delta to the counter stored at key in L2, and returns the new value. Any
+// copy of the counter in L1 is removed, since it is now out of date.
+func (t *TieredCache) Increment(key string, delta int64, ttl ...time.Duration) (int64, error) {
+	n, err := t.L2.Increment(key, delta, ttl...)
+	if err != nil {
+		return 0, err
+	}
+	return n, t.L1.Forget(key)
+}
+
+// Decrement atomically subtracts delta from the counter stored at key in L2, and returns the new
+// value. See Increment.
+func (t *TieredCache) Decrement(key string, delta int64, ttl ...time.Duration) (int64, error) {
+	return t.Increment(key, -delta, ttl...)
+}
+
+// TTL returns the time remaining before key expires in L2, or NoExpiration if it never expires.
+func (t *TieredCache) TTL(key string) (time.Duration, error) {
+	return t.L2.TTL(key)
+}
+
+// Touch sets the time remaining before key expires in L2 to ttl. If ttl is shorter than the time the
+// L1 copy has left, the L1 copy is shortened to match.
+func (t *TieredCache) Touch(key string, ttl time.Duration) error {
+	if err := t.L2.Touch(key, ttl); err != nil {
+		return err
+	}
+
+	if remaining, err := t.L1.TTL(key); err == nil && remaining > ttl {
+		return t.L1.Touch(key, ttl)
+	}
+	return nil
+}
+
+// Persist removes the expiry from key in L2. The L1 copy still expires after at most L1TTL.
+func (t *TieredCache) Persist(key string) error {
+	return t.L2.Persist(key)
+}
+
+// GetInt is a convenience method which retrieves a value from the cache, converts it to an int, and returns it.
+func (t *TieredCache) GetInt(key string) (int, error) {
+	return GetInt(t, key)
+}
+
+// GetString is a convenience method which retrieves a value from the cache and returns it as a string.
+func (t *TieredCache) GetString(key string) (string, error) {
+	return GetAs[string](t, key)
+}
+
+// GetTime retrieves a value from the cache by the specified key and returns it as time.Time.
+func (t *TieredCache) GetTime(key string) (time.Time, error) {
+	return GetAs[time.Time](t, key)
+}
@@ -0,0 +1,159 @@
+package remember
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestTieredCache(t *testing.T, l1TTL time.Duration) *TieredCache {
+	l1, err := New("memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2, err := New("redis", &Options{
+		Server: testRedis.Host(),
+		Port:   testRedis.Port(),
+		Prefix: "test_tiered",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewTiered(l1.(*MemoryCache), l2, l1TTL)
+	t.Cleanup(func() {
+		_ = c.Empty()
+		_ = c.Close()
+	})
+	return c
+}
+
+func TestTieredCache(t *testing.T) {
+	c := newTestTieredCache(t, 50*time.Millisecond)
+
+	// Read-through from L2.
+	_ = c.L2.Set("foo", "bar")
+	x, err := c.Get("foo")
+	if err != nil {
+		t.Error(err)
+	}
+	if x != "bar" {
+		t.Error("wrong value read through from L2:", x)
+	}
+	if !c.L1.Has("foo") {
+		t.Error("value read from L2 was not copied into L1")
+	}
+
+	// L1 serves reads until its copy expires.
+	_ = c.L2.Set("foo", "changed")
+	x, _ = c.Get("foo")
+	if x != "bar" {
+		t.Error("expected the L1 copy to be served, got", x)
+	}
+	time.Sleep(60 * time.Millisecond)
+	x, _ = c.Get("foo")
+	if x != "changed" {
+		t.Error("expected the L2 value after L1 expiry, got", x)
+	}
+
+	// Writes go to both tiers.
+	err = c.Set("alpha", "beta", time.Hour)
+	if err != nil {
+		t.Error(err)
+	}
+	if !c.L1.Has("alpha") || !c.L2.Has("alpha") {
+		t.Error("Set did not write to both tiers")
+	}
+	if ttl, _ := c.L1.TTL("alpha"); ttl > 50*time.Millisecond {
+		t.Error("L1 copy should not outlive L1TTL, has", ttl)
+	}
+
+	err = c.Forget("alpha")
+	if err != nil {
+		t.Error(err)
+	}
+	if c.L1.Has("alpha") || c.L2.Has("alpha") {
+		t.Error("Forget did not remove from both tiers")
+	}
+
+	_ = c.SetMany(map[string]any{"fooa": 1, "foob": 2, "bar": 3})
+	_ = c.L1.Forget("fooa")
+	found, err := c.GetMany([]string{"fooa", "foob", "bar", "missing"})
+	if err != nil {
+		t.Error(err)
+	}
+	if len(found) != 3 || found["fooa"] != 1 {
+		t.Error("wrong values from GetMany:", found)
+	}
+
+	err = c.EmptyByMatch("foo")
+	if err != nil {
+		t.Error(err)
+	}
+	for _, tier := range []CacheInterface{c.L1, c.L2} {
+		if tier.Has("fooa") || tier.Has("foob") || !tier.Has("bar") {
+			t.Error("EmptyByMatch removed the wrong keys")
+		}
+	}
+
+	// Counters live in L2, and any L1 copy is dropped when they change.
+	_, _ = c.Increment("hits", 1)
+	i, _ := c.GetInt("hits")
+	n, _ := c.Increment("hits", 1)
+	i, _ = c.GetInt("hits")
+	if n != 2 || i != 2 {
+		t.Errorf("expected counter of 2, got %d and %d", n, i)
+	}
+
+	x, err = c.Remember("remembered", time.Minute, func() (any, error) {
+		return "computed", nil
+	})
+	if err != nil || x != "computed" {
+		t.Error("unexpected result from Remember:", x, err)
+	}
+	if !c.L1.Has("remembered") || !c.L2.Has("remembered") {
+		t.Error("Remember did not store in both tiers")
+	}
+
+	err = c.Empty()
+	if err != nil {
+		t.Error(err)
+	}
+	if c.Has("bar") {
+		t.Error("Empty did not remove from both tiers")
+	}
+}
+
+func TestTieredCache_L2Expiry(t *testing.T) {
+	l1, err := NewMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2, err := NewBuntDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewTiered(l1, l2, time.Hour)
+	t.Cleanup(func() { _ = c.Close() })
+
+	_ = c.L2.Set("short", "lived", 100*time.Millisecond)
+	_ = c.L2.SetMany(map[string]any{"shortmany": "lived"}, 100*time.Millisecond)
+	if x, _ := c.Get("short"); x != "lived" {
+		t.Error("wrong value read through from L2:", x)
+	}
+	if found, _ := c.GetMany([]string{"shortmany"}); found["shortmany"] != "lived" {
+		t.Error("wrong values read through from L2:", found)
+	}
+	for _, key := range []string{"short", "shortmany"} {
+		if ttl, _ := c.L1.TTL(key); ttl > 100*time.Millisecond {
+			t.Errorf("L1 copy of %s should not outlive the L2 entry, has %s", key, ttl)
+		}
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if c.Has("short") {
+		t.Error("value was still served after it expired in L2")
+	}
+	if found, _ := c.GetMany([]string{"shortmany"}); len(found) != 0 {
+		t.Error("values were still served after they expired in L2:", found)
+	}
+}